@@ -0,0 +1,94 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/log"
+)
+
+// Agent runs benchmarks on behalf of a remote coordinator over HTTP
+//
+//	POST /start?at=<unix nanoseconds> starts a run at the given time
+//	GET  /result returns the result of the last run, 202 while it is running
+type Agent struct {
+	id    string
+	bench func() *Benchmark // a benchmark for every run
+
+	mu      sync.Mutex
+	running bool
+	result  *Result
+}
+
+// NewAgent returns an agent identified by id creating a benchmark per run with bench
+func NewAgent(id string, bench func() *Benchmark) *Agent {
+	return &Agent{
+		id:    id,
+		bench: bench,
+	}
+}
+
+// Serve listens on the address for the coordinator
+func (a *Agent) Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/start", a.handleStart)
+	mux.HandleFunc("/result", a.handleResult)
+	log.Infof("benchmark agent %s listening on %s", a.id, addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+func (a *Agent) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	at, err := strconv.ParseInt(r.URL.Query().Get("at"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid start time", http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running {
+		http.Error(w, "benchmark is running", http.StatusConflict)
+		return
+	}
+	a.running = true
+	a.result = nil
+	go a.run(time.Unix(0, at))
+}
+
+// run starts the benchmark at the given time, agents are expected to have synchronized clocks
+func (a *Agent) run(start time.Time) {
+	b := a.bench()
+	log.Infof("benchmark starts at %v", start)
+	time.Sleep(time.Until(start))
+	b.Run()
+	result := b.Result()
+	result.Client = a.id
+	a.mu.Lock()
+	a.running = false
+	a.result = result
+	a.mu.Unlock()
+}
+
+func (a *Agent) handleResult(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	running, result := a.running, a.result
+	a.mu.Unlock()
+	if running {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if result == nil {
+		http.Error(w, "no benchmark has run", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Error(err)
+	}
+}
@@ -1,8 +1,13 @@
 package benchmark
 
 import (
+	"bufio"
+	"math"
 	"math/rand"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gitferry/bamboo/config"
@@ -10,10 +15,15 @@ import (
 )
 
 var count uint64
+var written uint64
+
+// drainTimeout bounds the wait for the operations in flight when benchmark stops
+const drainTimeout = 10 * time.Second
 
 // DB is general interface implemented by client to call client library
 type DB interface {
 	Init() error
+	Read(key int) ([]byte, error)
 	Write(key int, value []byte) error
 	Stop() error
 }
@@ -25,6 +35,7 @@ func DefaultBConfig() config.Bconfig {
 		N:           0,
 		Throttle:    0,
 		Concurrency: 1,
+		W:           1,
 	}
 }
 
@@ -35,10 +46,16 @@ type Benchmark struct {
 	*History
 
 	rate      *Limiter
-	latency   []time.Duration // latency per operation
+	zipf      *rand.Zipf
+	trace     []request     // requests to replay
+	recorder  *bufio.Writer // records the generated requests
+	traceFile *os.File
+	samples   []Sample // latency per operation
+	result    *Result
 	startTime time.Time
 	counter   int
 
+	mu   sync.Mutex
 	wait sync.WaitGroup // waiting for all generated keys to complete
 }
 
@@ -51,6 +68,18 @@ func NewBenchmark(db DB) *Benchmark {
 	if b.Throttle > 0 {
 		b.rate = NewLimiter(b.Throttle)
 	}
+	if b.Distribution != "uniform" && b.K <= 0 {
+		log.Fatalf("distribution %s needs a key space K > 0", b.Distribution)
+	}
+	if b.Distribution == "exponential" && b.Lambda <= 0 {
+		log.Fatalf("invalid exponential parameter lambda=%v, need lambda > 0", b.Lambda)
+	}
+	if b.Distribution == "zipfian" {
+		b.zipf = rand.NewZipf(rand.New(rand.NewSource(time.Now().UnixNano())), b.ZipfianS, b.ZipfianV, uint64(b.K-1))
+		if b.zipf == nil {
+			log.Fatalf("invalid zipfian parameters s=%v v=%v, need s > 1 and v >= 1", b.ZipfianS, b.ZipfianV)
+		}
+	}
 	return b
 }
 
@@ -58,19 +87,24 @@ func NewBenchmark(db DB) *Benchmark {
 func (b *Benchmark) Run() {
 	var genCount, sendCount, confirmCount uint64
 
-	b.latency = make([]time.Duration, 0)
-	keys := make(chan int, b.Concurrency)
-	latencies := make(chan time.Duration, 1000)
-	defer close(latencies)
-	go b.collect(latencies)
+	b.samples = make([]Sample, 0)
+	requests := make(chan request, b.Concurrency)
+	samples := make(chan Sample, 1000)
+	go b.collect(samples)
 
 	for i := 0; i < b.Concurrency; i++ {
-		go b.worker(keys, latencies)
+		go b.worker(requests, samples)
 	}
 
 	b.db.Init()
 	b.startTime = time.Now()
-	if b.T > 0 {
+	if b.trace != nil {
+		genCount = b.replay(samples)
+		sendCount = genCount
+	} else if b.Rate > 0 {
+		genCount = b.openLoop(samples)
+		sendCount = genCount
+	} else if b.T > 0 {
 		timer := time.NewTimer(time.Second * time.Duration(b.T))
 	loop:
 		for {
@@ -81,9 +115,9 @@ func (b *Benchmark) Run() {
 			default:
 				b.wait.Add(1)
 				//log.Debugf("is generating key No.%v", j)
-				k := b.next()
+				r := b.next()
 				genCount++
-				keys <- k
+				requests <- r
 				sendCount++
 				//log.Debugf("generated key No.%v", j-1)
 			}
@@ -91,78 +125,218 @@ func (b *Benchmark) Run() {
 	} else {
 		for i := 0; i < b.N; i++ {
 			b.wait.Add(1)
-			keys <- b.next()
+			requests <- b.next()
 		}
-		b.wait.Wait()
 	}
+	close(requests)
+	b.drain()
+	b.stopRecording()
 
 	t := time.Now().Sub(b.startTime)
 
 	b.db.Stop()
-	close(keys)
-	stat := Statistic(b.latency)
-	confirmCount = uint64(len(b.latency))
+	b.mu.Lock()
+	results := b.samples
+	b.mu.Unlock()
+	latency := make([]time.Duration, len(results))
+	for i, s := range results {
+		latency[i] = s.Latency
+	}
+	stat := Statistic(latency)
+	confirmCount = uint64(len(latency))
 	log.Infof("Concurrency = %d", b.Concurrency)
 	log.Infof("Benchmark Time = %v\n", t)
-	log.Infof("Throughput = %f\n", float64(len(b.latency))/t.Seconds())
+	log.Infof("Throughput = %f\n", float64(len(latency))/t.Seconds())
 	log.Infof("genCount: %d, sendCount: %d, confirmCount: %d", genCount, sendCount, confirmCount)
 	log.Info(stat)
 
-	//stat.WriteFile("latency")
+	b.result = &Result{
+		Start:      b.startTime,
+		Duration:   t,
+		Operations: len(latency),
+		Throughput: float64(len(latency)) / t.Seconds(),
+		Histogram:  new(Histogram),
+	}
+	for _, l := range latency {
+		b.result.Histogram.Add(l)
+	}
+
+	if err := stat.WriteFile("latency"); err != nil {
+		log.Error(err)
+	}
+	if err := WriteSeries("series.csv", Series(results, time.Second), time.Second); err != nil {
+		log.Error(err)
+	}
 	//b.History.WriteFile("history")
+
+	if b.LinearizabilityCheck {
+		anomalies := b.History.Linearizable()
+		if len(anomalies) == 0 {
+			log.Info("The execution is linearizable.")
+		} else {
+			log.Infof("The execution is NOT linearizable, %d anomalies found:", len(anomalies))
+			for _, a := range anomalies {
+				log.Info(a)
+			}
+		}
+	}
+}
+
+// Result returns the result of the last run, nil before the run completes
+func (b *Benchmark) Result() *Result {
+	return b.result
+}
+
+// drain waits for the operations in flight, operations not completed within
+// drainTimeout are left out of the results
+func (b *Benchmark) drain() {
+	done := make(chan struct{})
+	go func() {
+		b.wait.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		log.Warningf("operations still in flight after %v are not counted", drainTimeout)
+	}
+}
+
+func (b *Benchmark) worker(requests <-chan request, result chan<- Sample) {
+	for r := range requests {
+		b.do(r, time.Now(), result)
+	}
+}
+
+// openLoop issues operations at Poisson arrivals of rate Rate, regardless of the
+// completion of earlier operations, and returns the number of operations issued
+func (b *Benchmark) openLoop(result chan<- Sample) uint64 {
+	var n uint64
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	end := b.startTime.Add(time.Duration(b.T) * time.Second)
+	arrival := b.startTime
+	for {
+		arrival = arrival.Add(time.Duration(r.ExpFloat64() / b.Rate * float64(time.Second)))
+		if b.T > 0 && arrival.After(end) || b.T <= 0 && n >= uint64(b.N) {
+			log.Infof("Benchmark stops")
+			return n
+		}
+		// operations behind schedule are issued at once
+		time.Sleep(time.Until(arrival))
+		b.wait.Add(1)
+		go b.do(b.request(arrival.Sub(b.startTime)), arrival, result)
+		n++
+	}
 }
 
-func (b *Benchmark) worker(keys <-chan int, result chan<- time.Duration) {
-	//var s time.Time
-	//var e time.Time
-	//var v int
-	//var err error
-	for k := range keys {
-		//op := new(operation)
-		//v = rand.Int()
-		//s = time.Now()
-		value := make([]byte, config.GetConfig().PayloadSize)
+// do executes one request, the latency counts from the arrival
+// of the request so that queueing in the client is not omitted
+func (b *Benchmark) do(r request, arrival time.Time, result chan<- Sample) {
+	k := r.key
+	op := new(operation)
+	s := time.Now()
+	var err error
+	if r.write {
+		value := make([]byte, r.size)
 		rand.Read(value)
-		//rand.Read(value)
-		_ = b.db.Write(k, value)
-		//res, err := strconv.Atoi(r)
-		//log.Debugf("latency is %v", time.Duration(res)*time.Nanosecond)
-		//e = time.Now()
-		//op.input = v
-		//op.start = s.Sub(b.startTime).Nanoseconds()
-		//if err == nil {
-		//op.end = e.Sub(b.startTime).Nanoseconds()
-		//result <- e.Sub(s)
-		//result <- time.Duration(res) * time.Nanosecond
-		//} else {
-		//op.end = math.MaxInt64
-		//log.Error(err)
-		//}
-		//b.History.AddOperation(k, op)
+		// written values are never empty and unique for the checker to tell writes apart
+		value = strconv.AppendUint(value, atomic.AddUint64(&written, 1), 10)
+		err = b.db.Write(k, value)
+		op.input = string(value)
+	} else {
+		var value []byte
+		value, err = b.db.Read(k)
+		if len(value) > 0 {
+			op.output = string(value)
+		}
+	}
+	e := time.Now()
+	if err == nil {
+		result <- Sample{Time: e.Sub(b.startTime), Latency: e.Sub(arrival)}
+	} else {
+		b.wait.Done()
+	}
+	if !b.LinearizabilityCheck {
+		return
+	}
+	op.start = s.Sub(b.startTime).Nanoseconds()
+	op.end = e.Sub(b.startTime).Nanoseconds()
+	if err != nil {
+		if op.input == nil {
+			// a failed read returns nothing
+			return
+		}
+		// the write may still take effect at any time later
+		op.end = math.MaxInt64
 	}
+	b.History.AddOperation(k, op)
 }
 
-// generates key based on distribution
-func (b *Benchmark) next() int {
+// generates request based on distribution, throttled in closed loop
+func (b *Benchmark) next() request {
+	if b.Throttle > 0 {
+		b.rate.Wait()
+	}
+	return b.request(time.Since(b.startTime))
+}
+
+// request draws the key and operation of a request issued at the time since start and records it
+func (b *Benchmark) request(t time.Duration) request {
+	r := request{
+		time:  t,
+		key:   b.key(),
+		write: rand.Float64() < b.W,
+	}
+	if r.write {
+		r.size = config.GetConfig().PayloadSize
+	}
+	b.record(r)
+	return r
+}
+
+// key draws a key from the distribution
+func (b *Benchmark) key() int {
 	var key int
 	switch b.Distribution {
 	case "uniform":
 		key = int(count)
 		count += uint64(config.GetConfig().N() - config.GetConfig().ByzNo)
+
+	case "conflict":
+		// conflicting operations share key 0, the others spread over K keys from Min
+		if rand.Intn(100) < b.Conflicts {
+			key = 0
+		} else {
+			b.counter = (b.counter + 1) % b.K
+			key = b.counter + b.Min
+		}
+
+	case "normal":
+		mu := b.Mu
+		if b.Move && b.Speed > 0 {
+			// the mean moves by one key every Speed milliseconds
+			mu += float64(time.Since(b.startTime).Milliseconds() / int64(b.Speed))
+		}
+		key = int(rand.NormFloat64()*b.Sigma + mu)
+		key = ((key % b.K) + b.K) % b.K
+
+	case "zipfian":
+		key = int(b.zipf.Uint64())
+
+	case "exponential":
+		key = int(rand.ExpFloat64()/b.Lambda) % b.K
+
 	default:
 		log.Fatalf("unknown distribution %s", b.Distribution)
 	}
-
-	if b.Throttle > 0 {
-		b.rate.Wait()
-	}
-
 	return key
 }
 
-func (b *Benchmark) collect(latencies <-chan time.Duration) {
-	for t := range latencies {
-		b.latency = append(b.latency, t)
+func (b *Benchmark) collect(samples <-chan Sample) {
+	for s := range samples {
+		b.mu.Lock()
+		b.samples = append(b.samples, s)
+		b.mu.Unlock()
 		b.wait.Done()
 	}
 }
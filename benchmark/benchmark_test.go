@@ -0,0 +1,247 @@
+package benchmark
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/stretchr/testify/require"
+)
+
+// memDB is a DB in memory that records the keys of the operations in order
+type memDB struct {
+	mu     sync.Mutex
+	data   map[int][]byte
+	keys   []int
+	failed bool // operations fail
+}
+
+func newMemDB() *memDB {
+	return &memDB{data: make(map[int][]byte)}
+}
+
+func (d *memDB) Init() error { return nil }
+func (d *memDB) Stop() error { return nil }
+
+func (d *memDB) Read(key int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = append(d.keys, key)
+	if d.failed {
+		return nil, errors.New("read failed")
+	}
+	return d.data[key], nil
+}
+
+func (d *memDB) Write(key int, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.keys = append(d.keys, key)
+	if d.failed {
+		return errors.New("write failed")
+	}
+	d.data[key] = value
+	return nil
+}
+
+func newTestBenchmark(db DB, c config.Bconfig) *Benchmark {
+	return &Benchmark{
+		db:        db,
+		Bconfig:   c,
+		History:   NewHistory(),
+		startTime: time.Now(),
+	}
+}
+
+func TestDo(t *testing.T) {
+	db := newMemDB()
+	b := newTestBenchmark(db, config.Bconfig{LinearizabilityCheck: true})
+	samples := make(chan Sample, 4)
+
+	b.wait.Add(1)
+	b.do(request{key: 1, size: 8, write: true}, time.Now(), samples)
+	require.Len(t, samples, 1)
+	written := db.data[1]
+	require.True(t, len(written) > 8)
+	b.wait.Add(1)
+	b.do(request{key: 1, write: true}, time.Now(), samples)
+	// writes without payload are still unique
+	require.NotEqual(t, written, db.data[1])
+	written = db.data[1]
+
+	b.wait.Add(1)
+	b.do(request{key: 1}, time.Now(), samples)
+	require.Len(t, samples, 3)
+	ops := b.History.shard[1]
+	require.Len(t, ops, 3)
+	require.Equal(t, string(written), ops[1].input)
+	require.Nil(t, ops[1].output)
+	require.Equal(t, string(written), ops[2].output)
+	require.Nil(t, ops[2].input)
+	require.True(t, ops[2].start <= ops[2].end)
+
+	// a read of a key never written returns nothing
+	b.wait.Add(1)
+	b.do(request{key: 2}, time.Now(), samples)
+	require.Nil(t, b.History.shard[2][0].output)
+}
+
+func TestDoFailed(t *testing.T) {
+	db := newMemDB()
+	db.failed = true
+	b := newTestBenchmark(db, config.Bconfig{LinearizabilityCheck: true})
+	samples := make(chan Sample, 2)
+
+	b.wait.Add(2)
+	b.do(request{key: 1, write: true}, time.Now(), samples)
+	b.do(request{key: 1}, time.Now(), samples)
+	require.Empty(t, samples)
+	// failed operations are not waited for
+	b.wait.Wait()
+
+	// a failed write may take effect any time later, a failed read is left out
+	ops := b.History.shard[1]
+	require.Len(t, ops, 1)
+	require.NotNil(t, ops[0].input)
+	require.Equal(t, int64(math.MaxInt64), ops[0].end)
+}
+
+func TestRequestWriteRatio(t *testing.T) {
+	b := newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "uniform"})
+	for i := 0; i < 100; i++ {
+		require.False(t, b.request(0).write)
+	}
+	b.W = 1
+	for i := 0; i < 100; i++ {
+		r := b.request(0)
+		require.True(t, r.write)
+		require.Equal(t, config.GetConfig().PayloadSize, r.size)
+	}
+}
+
+func TestOpenLoopArrivals(t *testing.T) {
+	const n = 4000
+	db := newMemDB()
+	b := newTestBenchmark(db, config.Bconfig{Rate: 10000, N: n, W: 1, Distribution: "uniform"})
+	var trace bytes.Buffer
+	b.recorder = bufio.NewWriter(&trace)
+	samples := make(chan Sample, n)
+	go b.collect(samples)
+
+	require.Equal(t, uint64(n), b.openLoop(samples))
+	b.wait.Wait()
+	require.Len(t, b.samples, n)
+	require.NoError(t, b.recorder.Flush())
+
+	// the gaps between the arrivals are exponential with mean 1/lambda, their
+	// standard deviation equals their mean
+	var last, sum, squares float64
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	require.Len(t, lines, n)
+	for _, line := range lines {
+		arrival, err := strconv.ParseFloat(strings.Split(line, ",")[0], 64)
+		require.NoError(t, err)
+		gap := (arrival - last) / float64(time.Second)
+		require.True(t, gap >= 0)
+		sum += gap
+		squares += gap * gap
+		last = arrival
+	}
+	// the operations are issued at their arrivals, not ahead of them
+	require.True(t, time.Since(b.startTime) >= time.Duration(last))
+	mean := sum / n
+	std := math.Sqrt(squares/n - mean*mean)
+	require.InEpsilon(t, 1.0/10000, mean, 0.1)
+	require.InEpsilon(t, mean, std, 0.15)
+}
+
+// keys draws n keys of the distribution from a seeded source, checking they are within [low, high)
+func keys(t *testing.T, b *Benchmark, n, low, high int) []int {
+	rand.Seed(1)
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = b.key()
+		require.True(t, keys[i] >= low && keys[i] < high, "key %v out of [%v, %v)", keys[i], low, high)
+	}
+	return keys
+}
+
+func mean(keys []int) float64 {
+	sum := 0
+	for _, k := range keys {
+		sum += k
+	}
+	return float64(sum) / float64(len(keys))
+}
+
+func TestKeyDistributions(t *testing.T) {
+	const n = 10000
+
+	b := newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "uniform"})
+	uniform := keys(t, b, n, 0, math.MaxInt32)
+	step := config.GetConfig().N() - config.GetConfig().ByzNo
+	for i := 1; i < n; i++ {
+		require.Equal(t, step, uniform[i]-uniform[i-1])
+	}
+
+	// a share of conflicting operations on key 0, the others cycle over K keys from Min
+	b = newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "conflict", K: 10, Min: 100, Conflicts: 30})
+	conflicts, others := 0, make(map[int]int)
+	for _, k := range keys(t, b, n, 0, 110) {
+		if k == 0 {
+			conflicts++
+			continue
+		}
+		require.True(t, k >= 100)
+		others[k]++
+	}
+	require.InDelta(t, 0.3, float64(conflicts)/n, 0.02)
+	require.Len(t, others, 10)
+
+	b = newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "normal", K: 100, Mu: 50, Sigma: 5})
+	normal := keys(t, b, n, 0, 100)
+	// the keys are truncated, their mean is half a key below mu
+	require.InDelta(t, 49.5, mean(normal), 0.3)
+	within := 0
+	for _, k := range normal {
+		if k >= 45 && k <= 55 {
+			within++
+		}
+	}
+	require.InDelta(t, 0.68, float64(within)/n, 0.1)
+	// the mean moves by a key every Speed ms, wrapping around K
+	b.Move, b.Speed = true, 1000
+	b.startTime = time.Now().Add(-70 * time.Second)
+	require.InDelta(t, 19.5, mean(keys(t, b, n, 0, 100)), 0.3)
+
+	// the probability of key k is proportional to (v+k)^-s, about 0.61 for key 0 with s = 2 and v = 1
+	b = newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "zipfian", K: 100})
+	b.zipf = rand.NewZipf(rand.New(rand.NewSource(1)), 2, 1, 99)
+	counts := make([]int, 100)
+	for _, k := range keys(t, b, n, 0, 100) {
+		counts[k]++
+	}
+	require.InDelta(t, 0.61, float64(counts[0])/n, 0.02)
+	require.InDelta(t, 4, float64(counts[0])/float64(counts[1]), 0.4)
+	require.True(t, counts[1] > counts[2] && counts[2] > counts[3])
+
+	b = newTestBenchmark(newMemDB(), config.Bconfig{Distribution: "exponential", K: 1000, Lambda: 0.1})
+	exponential := keys(t, b, n, 0, 1000)
+	require.InDelta(t, 9.5, mean(exponential), 0.3)
+	small := 0
+	for _, k := range exponential {
+		if k < 10 {
+			small++
+		}
+	}
+	// P(key < mean) = 1 - 1/e
+	require.InDelta(t, 1-1/math.E, float64(small)/n, 0.02)
+}
@@ -0,0 +1,102 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gitferry/bamboo/log"
+)
+
+// pollInterval is how often the coordinator asks the agents for their results
+const pollInterval = time.Second
+
+// Coordinator drives the benchmark agents to run at the same time and aggregates their results
+type Coordinator struct {
+	Agents  []string      // agent urls, e.g. http://10.0.0.2:8090
+	Delay   time.Duration // delay of the start for every agent to receive it
+	Timeout time.Duration // bound of the wait for the results, unbounded if 0
+
+	client http.Client
+}
+
+// NewCoordinator returns a coordinator of the agents
+func NewCoordinator(agents []string) *Coordinator {
+	return &Coordinator{
+		Agents: agents,
+		Delay:  2 * time.Second,
+	}
+}
+
+// Run starts all agents at the same time, waits for their results and aggregates them
+func (c *Coordinator) Run() (*Report, error) {
+	if len(c.Agents) == 0 {
+		return nil, errors.New("no benchmark agents")
+	}
+	start := time.Now().Add(c.Delay)
+	at := strconv.FormatInt(start.UnixNano(), 10)
+	for _, agent := range c.Agents {
+		r, err := c.client.Post(agent+"/start?at="+at, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("agent %s: %s", agent, r.Status)
+		}
+	}
+	log.Infof("%d agents start at %v", len(c.Agents), start)
+
+	time.Sleep(time.Until(start))
+	var deadline <-chan time.Time
+	if c.Timeout > 0 {
+		deadline = time.After(c.Timeout)
+	}
+	results := make([]*Result, len(c.Agents))
+	pending := len(c.Agents)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for pending > 0 {
+		select {
+		case <-deadline:
+			return nil, fmt.Errorf("%d agents have not finished after %v", pending, c.Timeout)
+		case <-ticker.C:
+		}
+		for i, agent := range c.Agents {
+			if results[i] != nil {
+				continue
+			}
+			result, err := c.result(agent)
+			if err != nil {
+				return nil, err
+			}
+			if result != nil {
+				results[i] = result
+				pending--
+			}
+		}
+	}
+	return Aggregate(results), nil
+}
+
+// result returns the result of the agent, nil while it is running
+func (c *Coordinator) result(agent string) (*Result, error) {
+	r, err := c.client.Get(agent + "/result")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	switch r.StatusCode {
+	case http.StatusAccepted:
+		return nil, nil
+	case http.StatusOK:
+		result := new(Result)
+		err = json.NewDecoder(r.Body).Decode(result)
+		return result, err
+	default:
+		return nil, fmt.Errorf("agent %s: %s", agent, r.Status)
+	}
+}
@@ -0,0 +1,150 @@
+package benchmark
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A history of a register with unique written values is checked following
+// Gibbons and Korach: every write and the reads returning its value form a cluster.
+// The cluster holds the register from the earliest end to the latest start of its
+// operations, its zone. The history is linearizable iff every read returns a value
+// written before it ends, no two forward zones overlap, and no backward zone lies
+// inside a forward zone.
+
+// cluster is a write together with the reads returning its value
+type cluster struct {
+	write *operation
+	reads []*operation
+	end   int64 // earliest end of the operations
+	start int64 // latest start of the operations
+}
+
+func (c *cluster) add(o *operation) {
+	if o.end < c.end {
+		c.end = o.end
+	}
+	if o.start > c.start {
+		c.start = o.start
+	}
+}
+
+// forward zones span from end to start, the register holds the value throughout
+func (c *cluster) forward() bool {
+	return c.end < c.start
+}
+
+// Anomaly is a set of operations that cannot be linearized
+type Anomaly struct {
+	Reason     string
+	Operations []*operation
+}
+
+func (a Anomaly) String() string {
+	return fmt.Sprintf("%s: %v", a.Reason, a.Operations)
+}
+
+// linearizable checks the operations on a single key and returns the anomalies found,
+// operations with a nil input are reads, a nil output of a read is the initial value
+func linearizable(history []*operation) []Anomaly {
+	var anomalies []Anomaly
+	// the initial value is written before any operation
+	initial := &cluster{
+		write: &operation{start: math.MinInt64, end: math.MinInt64},
+		end:   math.MinInt64,
+		start: math.MinInt64,
+	}
+	clusters := map[interface{}]*cluster{nil: initial}
+	for _, o := range history {
+		if o.input == nil {
+			continue
+		}
+		if _, exists := clusters[o.input]; exists {
+			anomalies = append(anomalies, Anomaly{"value written twice", []*operation{clusters[o.input].write, o}})
+			continue
+		}
+		clusters[o.input] = &cluster{write: o, end: o.end, start: o.start}
+	}
+	for _, o := range history {
+		if o.input != nil {
+			continue
+		}
+		c, exists := clusters[o.output]
+		if !exists {
+			anomalies = append(anomalies, Anomaly{"read a value never written", []*operation{o}})
+			continue
+		}
+		if o.happenBefore(*c.write) {
+			anomalies = append(anomalies, Anomaly{"read a value before it was written", []*operation{c.write, o}})
+			continue
+		}
+		c.reads = append(c.reads, o)
+		c.add(o)
+	}
+
+	var forward, backward []*cluster
+	for _, c := range clusters {
+		if c == initial && len(c.reads) == 0 {
+			continue
+		}
+		if c.forward() {
+			forward = append(forward, c)
+		} else {
+			backward = append(backward, c)
+		}
+	}
+
+	// forward zones must not overlap, once sorted it is enough to check the neighbours
+	sort.Slice(forward, func(i, j int) bool { return forward[i].end < forward[j].end })
+	disjoint := forward[:0:0]
+	for _, c := range forward {
+		if len(disjoint) > 0 {
+			last := disjoint[len(disjoint)-1]
+			if c.end < last.start {
+				anomalies = append(anomalies, Anomaly{"overlapping values", append(last.operations(), c.operations()...)})
+				continue
+			}
+		}
+		disjoint = append(disjoint, c)
+	}
+
+	// backward zones must not lie inside a forward zone, the only candidate is
+	// the last forward zone beginning before the backward zone
+	for _, c := range backward {
+		i := sort.Search(len(disjoint), func(i int) bool { return disjoint[i].end >= c.start })
+		if i == 0 {
+			continue
+		}
+		f := disjoint[i-1]
+		if c.end < f.start {
+			anomalies = append(anomalies, Anomaly{"value hidden by another", append(f.operations(), c.operations()...)})
+		}
+	}
+	return anomalies
+}
+
+func (c *cluster) operations() []*operation {
+	ops := make([]*operation, 0, len(c.reads)+1)
+	if c.write.input != nil {
+		ops = append(ops, c.write)
+	}
+	return append(ops, c.reads...)
+}
+
+// Linearizable checks every key of the history concurrently and returns the anomalies found
+func (h *History) Linearizable() []Anomaly {
+	h.RLock()
+	defer h.RUnlock()
+	results := make(chan []Anomaly)
+	for _, partition := range h.shard {
+		go func(p []*operation) {
+			results <- linearizable(p)
+		}(partition)
+	}
+	var anomalies []Anomaly
+	for range h.shard {
+		anomalies = append(anomalies, <-results...)
+	}
+	return anomalies
+}
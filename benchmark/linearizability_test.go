@@ -0,0 +1,76 @@
+package benchmark
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func write(v string, start, end int64) *operation {
+	return &operation{input: v, start: start, end: end}
+}
+
+func read(v interface{}, start, end int64) *operation {
+	return &operation{output: v, start: start, end: end}
+}
+
+func TestLinearizable(t *testing.T) {
+	// concurrent writes may be read in either order
+	require.Empty(t, linearizable([]*operation{
+		write("a", 0, 10),
+		write("b", 5, 15),
+		read("b", 16, 20),
+		read(nil, 0, 3),
+	}))
+	require.Empty(t, linearizable([]*operation{
+		write("a", 0, 10),
+		write("b", 5, 15),
+		read("a", 16, 20),
+	}))
+}
+
+func TestLinearizableStaleRead(t *testing.T) {
+	anomalies := linearizable([]*operation{
+		write("a", 0, 10),
+		write("b", 11, 20),
+		read("a", 21, 30),
+	})
+	require.Len(t, anomalies, 1)
+
+	anomalies = linearizable([]*operation{
+		write("a", 0, 10),
+		read(nil, 11, 20),
+	})
+	require.Len(t, anomalies, 1)
+}
+
+func TestLinearizableFutureRead(t *testing.T) {
+	require.Len(t, linearizable([]*operation{
+		read("a", 0, 5),
+		write("a", 10, 20),
+	}), 1)
+	require.Len(t, linearizable([]*operation{
+		read("c", 0, 5),
+	}), 1)
+}
+
+func TestLinearizableOverlappingValues(t *testing.T) {
+	// a is read after b is read, then b again
+	anomalies := linearizable([]*operation{
+		write("a", 0, 5),
+		write("b", 0, 5),
+		read("a", 6, 7),
+		read("b", 8, 9),
+		read("a", 10, 11),
+	})
+	require.Len(t, anomalies, 1)
+}
+
+func TestHistoryLinearizable(t *testing.T) {
+	h := NewHistory()
+	h.Add(1, "a", nil, 0, 10)
+	h.Add(1, nil, "a", 11, 12)
+	h.Add(2, "a", nil, 0, 10)
+	h.Add(2, nil, nil, 11, 12)
+	require.Len(t, h.Linearizable(), 1)
+}
@@ -0,0 +1,167 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+// latency histogram buckets grow exponentially from histogramBase by histogramGrowth,
+// the relative error of a percentile is below 5%
+const (
+	histogramBase   = 10 * time.Microsecond
+	histogramGrowth = 1.05
+)
+
+// Histogram counts latencies in buckets, histograms of several clients can be merged
+type Histogram struct {
+	Counts []uint64      `json:"counts"`
+	Total  uint64        `json:"total"`
+	Sum    time.Duration `json:"sum"`
+}
+
+func bucketOf(d time.Duration) int {
+	if d < histogramBase {
+		return 0
+	}
+	return int(math.Log(float64(d)/float64(histogramBase))/math.Log(histogramGrowth)) + 1
+}
+
+// upperBound is the largest latency counted in bucket i
+func upperBound(i int) time.Duration {
+	return time.Duration(float64(histogramBase) * math.Pow(histogramGrowth, float64(i)))
+}
+
+// Add counts the latency
+func (h *Histogram) Add(d time.Duration) {
+	i := bucketOf(d)
+	for len(h.Counts) <= i {
+		h.Counts = append(h.Counts, 0)
+	}
+	h.Counts[i]++
+	h.Total++
+	h.Sum += d
+}
+
+// Merge adds the counts of o
+func (h *Histogram) Merge(o *Histogram) {
+	for len(h.Counts) < len(o.Counts) {
+		h.Counts = append(h.Counts, 0)
+	}
+	for i, c := range o.Counts {
+		h.Counts[i] += c
+	}
+	h.Total += o.Total
+	h.Sum += o.Sum
+}
+
+// Mean returns the mean latency
+func (h *Histogram) Mean() time.Duration {
+	if h.Total == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Total)
+}
+
+// Percentile returns the latency below which the fraction p of the latencies are
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.Total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(p * float64(h.Total)))
+	var count uint64
+	for i, c := range h.Counts {
+		count += c
+		if count >= rank {
+			return upperBound(i)
+		}
+	}
+	return upperBound(len(h.Counts) - 1)
+}
+
+// Result is the outcome of a benchmark run of one client
+type Result struct {
+	Client     string        `json:"client"`
+	Start      time.Time     `json:"start"`
+	Duration   time.Duration `json:"duration"`
+	Operations int           `json:"operations"`
+	Throughput float64       `json:"throughput"` // operations per second
+	Histogram  *Histogram    `json:"histogram"`
+}
+
+// Summary is the throughput and latency percentiles in milliseconds of a result
+type Summary struct {
+	Client     string  `json:"client"`
+	Operations int     `json:"operations"`
+	Throughput float64 `json:"throughput"`
+	Mean       float64 `json:"mean"`
+	Median     float64 `json:"median"`
+	P95        float64 `json:"p95"`
+	P99        float64 `json:"p99"`
+	P999       float64 `json:"p999"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1000000.0
+}
+
+// Summary summarizes the result
+func (r *Result) Summary() Summary {
+	return Summary{
+		Client:     r.Client,
+		Operations: r.Operations,
+		Throughput: r.Throughput,
+		Mean:       ms(r.Histogram.Mean()),
+		Median:     ms(r.Histogram.Percentile(0.5)),
+		P95:        ms(r.Histogram.Percentile(0.95)),
+		P99:        ms(r.Histogram.Percentile(0.99)),
+		P999:       ms(r.Histogram.Percentile(0.999)),
+	}
+}
+
+// Report aggregates the results of clients running at the same time
+type Report struct {
+	Clients []Summary `json:"clients"`
+	Total   Summary   `json:"total"`
+}
+
+// Aggregate merges the results, throughputs add up and latencies are taken from the merged histogram
+func Aggregate(results []*Result) *Report {
+	total := &Result{Client: "total", Histogram: new(Histogram)}
+	report := new(Report)
+	for _, r := range results {
+		report.Clients = append(report.Clients, r.Summary())
+		total.Operations += r.Operations
+		total.Throughput += r.Throughput
+		total.Histogram.Merge(r.Histogram)
+	}
+	report.Total = total.Summary()
+	return report
+}
+
+// WriteFile writes the report as path.json and path.csv
+func (r *Report) WriteFile(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path+".json", b, 0644); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path + ".csv")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "client,operations,throughput,mean,median,p95,p99,p999")
+	for _, s := range append(r.Clients, r.Total) {
+		fmt.Fprintf(w, "%s,%d,%f,%f,%f,%f,%f,%f\n", s.Client, s.Operations, s.Throughput, s.Mean, s.Median, s.P95, s.P99, s.P999)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,35 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	h := new(Histogram)
+	for i := 1; i <= 1000; i++ {
+		h.Add(time.Duration(i) * time.Millisecond)
+	}
+	require.Equal(t, uint64(1000), h.Total)
+	require.InEpsilon(t, float64(500*time.Millisecond), float64(h.Percentile(0.5)), 0.05)
+	require.InEpsilon(t, float64(990*time.Millisecond), float64(h.Percentile(0.99)), 0.05)
+	require.Equal(t, 500500*time.Microsecond, h.Mean())
+}
+
+func TestAggregate(t *testing.T) {
+	a := &Result{Client: "a", Operations: 2, Throughput: 1, Histogram: new(Histogram)}
+	a.Histogram.Add(time.Millisecond)
+	a.Histogram.Add(time.Millisecond)
+	b := &Result{Client: "b", Operations: 2, Throughput: 2, Histogram: new(Histogram)}
+	b.Histogram.Add(time.Second)
+	b.Histogram.Add(time.Second)
+
+	r := Aggregate([]*Result{a, b})
+	require.Len(t, r.Clients, 2)
+	require.Equal(t, 4, r.Total.Operations)
+	require.Equal(t, 3.0, r.Total.Throughput)
+	require.InEpsilon(t, 1.0, r.Total.Median, 0.05)
+	require.InEpsilon(t, 1000.0, r.Total.P99, 0.05)
+}
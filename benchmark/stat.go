@@ -47,6 +47,9 @@ func Statistic(latency []time.Duration) Stat {
 		ms = append(ms, float64(l.Nanoseconds())/1000000.0)
 	}
 	sort.Float64s(ms)
+	if len(ms) == 0 {
+		return Stat{Data: ms}
+	}
 	sum := 0.0
 	for _, m := range ms {
 		sum += m
@@ -64,3 +67,44 @@ func Statistic(latency []time.Duration) Stat {
 		P999:   ms[int(0.999*float64(size))],
 	}
 }
+
+// Sample is the latency of an operation and the time it completed, since the start of benchmark
+type Sample struct {
+	Time    time.Duration
+	Latency time.Duration
+}
+
+// Series groups the samples into intervals by the time they completed
+// and creates a Stat object for each interval
+func Series(samples []Sample, interval time.Duration) []Stat {
+	var buckets [][]time.Duration
+	for _, s := range samples {
+		i := int(s.Time / interval)
+		for len(buckets) <= i {
+			buckets = append(buckets, nil)
+		}
+		buckets[i] = append(buckets[i], s.Latency)
+	}
+	series := make([]Stat, len(buckets))
+	for i, latency := range buckets {
+		series[i] = Statistic(latency)
+	}
+	return series
+}
+
+// WriteSeries writes the throughput and latency of each interval into a csv file in path
+func WriteSeries(path string, series []Stat, interval time.Duration) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	fmt.Fprintln(w, "time,throughput,mean,min,max,median,p95,p99,p999")
+	for i, s := range series {
+		t := time.Duration(i+1) * interval
+		fmt.Fprintf(w, "%f,%f,%f,%f,%f,%f,%f,%f,%f\n", t.Seconds(), float64(s.Size)/interval.Seconds(), s.Mean, s.Min, s.Max, s.Median, s.P95, s.P99, s.P999)
+	}
+	return w.Flush()
+}
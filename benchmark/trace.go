@@ -0,0 +1,119 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gitferry/bamboo/log"
+)
+
+// request is a generated operation, a trace is the list of requests in csv
+// with one line per request: time since start in nanoseconds,key,payload size,w or r
+type request struct {
+	time  time.Duration
+	key   int
+	size  int // payload size of a write
+	write bool
+}
+
+// Record writes every generated request to the trace file in path
+func (b *Benchmark) Record(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	b.traceFile = file
+	b.recorder = bufio.NewWriter(file)
+	return nil
+}
+
+func (b *Benchmark) record(r request) {
+	if b.recorder == nil {
+		return
+	}
+	op := "r"
+	if r.write {
+		op = "w"
+	}
+	fmt.Fprintf(b.recorder, "%d,%d,%d,%s\n", r.time.Nanoseconds(), r.key, r.size, op)
+}
+
+func (b *Benchmark) stopRecording() {
+	if b.recorder == nil {
+		return
+	}
+	if err := b.recorder.Flush(); err != nil {
+		log.Error(err)
+	}
+	if err := b.traceFile.Close(); err != nil {
+		log.Error(err)
+	}
+	b.recorder = nil
+}
+
+// Replay loads the trace file in path, Run then reissues the requests of the trace
+// at their original times instead of generating new ones
+func (b *Benchmark) Replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = 4
+	trace := make([]request, 0)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		t, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		key, err := strconv.Atoi(record[1])
+		if err != nil {
+			return err
+		}
+		size, err := strconv.Atoi(record[2])
+		if err != nil {
+			return err
+		}
+		if record[3] != "w" && record[3] != "r" {
+			return errors.New("trace file format error: operation is neither w nor r")
+		}
+		trace = append(trace, request{
+			time:  time.Duration(t),
+			key:   key,
+			size:  size,
+			write: record[3] == "w",
+		})
+	}
+	b.trace = trace
+	return nil
+}
+
+// replay issues the requests of the trace open loop at their recorded times
+// and returns the number of requests issued
+func (b *Benchmark) replay(result chan<- Sample) uint64 {
+	var n uint64
+	for _, r := range b.trace {
+		arrival := b.startTime.Add(r.time)
+		time.Sleep(time.Until(arrival))
+		b.wait.Add(1)
+		go b.do(r, arrival, result)
+		n++
+	}
+	log.Infof("Benchmark stops, %d requests replayed", n)
+	return n
+}
@@ -0,0 +1,74 @@
+package benchmark
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "trace.csv")
+
+	b := newTestBenchmark(newMemDB(), config.Bconfig{K: 100, W: 0.5, Distribution: "conflict", Conflicts: 50})
+	require.NoError(t, b.Record(path))
+	var recorded []request
+	for i := 0; i < 50; i++ {
+		recorded = append(recorded, b.request(time.Duration(i)*time.Millisecond))
+	}
+	b.stopRecording()
+
+	db := newMemDB()
+	replayed := newTestBenchmark(db, config.Bconfig{})
+	require.NoError(t, replayed.Replay(path))
+	require.Equal(t, recorded, replayed.trace)
+
+	// the requests are issued again at their recorded times
+	samples := make(chan Sample, len(recorded))
+	go replayed.collect(samples)
+	replayed.startTime = time.Now()
+	require.Equal(t, uint64(len(recorded)), replayed.replay(samples))
+	replayed.wait.Wait()
+	require.True(t, time.Since(replayed.startTime) >= recorded[len(recorded)-1].time)
+	keys := make(map[int]int)
+	for _, r := range recorded {
+		keys[r.key]++
+	}
+	replayedKeys := make(map[int]int)
+	for _, k := range db.keys {
+		replayedKeys[k]++
+	}
+	require.Equal(t, keys, replayedKeys)
+	for _, r := range recorded {
+		if r.write {
+			require.NotEmpty(t, db.data[r.key])
+		}
+	}
+}
+
+func TestReplayMalformed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trace")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := newTestBenchmark(newMemDB(), config.Bconfig{})
+	for _, trace := range []string{
+		"1,2,3\n",
+		"x,1,0,r\n",
+		"1,x,0,r\n",
+		"1,1,x,w\n",
+		"1,1,0,d\n",
+	} {
+		path := filepath.Join(dir, "trace.csv")
+		require.NoError(t, ioutil.WriteFile(path, []byte(trace), 0644))
+		require.Error(t, b.Replay(path), trace)
+	}
+	require.Error(t, b.Replay(filepath.Join(dir, "missing.csv")))
+}
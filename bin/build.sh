@@ -2,4 +2,5 @@
 
 # 编译 server 和 client
 go build ../server
-go build ../client
\ No newline at end of file
+go build ../client
+go build ../checker
@@ -1,22 +1,20 @@
+import json
 import statistics
-import os
-path = "."
-s = []
+import sys
+
+# reads the view durations from a server log written with -log_format=json -log_levels=replica=debug
 durations = []
-totalThroughput = 0.0
-totalLatency = 0.0
-f = open("server.30314.log")
-counter = 0
+f = open(sys.argv[1] if len(sys.argv) > 1 else "server.log")
 for line in iter(f):
-    if "millisecond" in line:
-        for item in line.strip().split(" "):
-            if "ms" in item:
-                duration = float(item[:-2])
-                durations.append(duration)
-                counter += 1
-    if counter == 1000000:
+    try:
+        entry = json.loads(line)
+    except ValueError:
+        continue
+    if entry.get("msg") == "the last view ended":
+        durations.append(float(entry["duration_ms"]))
+    if len(durations) == 1000000:
         break
-        
+
 f.close()
 print("mean is:", statistics.mean(durations))
-print("var is:", statistics.variance(durations))
\ No newline at end of file
+print("var is:", statistics.variance(durations))
@@ -6,6 +6,7 @@ import (
 	"github.com/gitferry/bamboo/crypto"
 	"github.com/gitferry/bamboo/identity"
 	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/trace"
 	"github.com/gitferry/bamboo/types"
 )
 
@@ -16,10 +17,12 @@ type Block struct {
 	Proposer  identity.NodeID
 	Timestamp time.Time
 	Payload   []*message.Transaction
+	Digests   []crypto.Identifier // batches of transactions disseminated by the workers
 	PrevID    crypto.Identifier
 	Sig       crypto.Signature
 	ID        crypto.Identifier
 	Ts        time.Duration
+	Trace     trace.Context // trace of the proposal, not part of the id
 }
 
 type rawBlock struct {
@@ -27,29 +30,42 @@ type rawBlock struct {
 	QC       *QC
 	Proposer identity.NodeID
 	Payload  []string
+	Digests  []crypto.Identifier
 	PrevID   crypto.Identifier
 	Sig      crypto.Signature
 	ID       crypto.Identifier
 }
 
-// MakeBlock creates an unsigned block
-func MakeBlock(view types.View, qc *QC, prevID crypto.Identifier, payload []*message.Transaction, proposer identity.NodeID) *Block {
+// MakeBlock creates an unsigned block, its transactions are either in the payload
+// or referred to by the digests of their batches
+func MakeBlock(view types.View, qc *QC, prevID crypto.Identifier, payload []*message.Transaction, digests []crypto.Identifier, proposer identity.NodeID) *Block {
 	b := new(Block)
 	b.View = view
 	b.Proposer = proposer
 	b.QC = qc
 	b.Payload = payload
+	b.Digests = digests
 	b.PrevID = prevID
 	b.makeID(proposer)
 
 	return b
 }
 
+// digestsOf returns nil for no digests, gob decodes an empty slice as nil and the id
+// must not depend on which of the two a block carries
+func digestsOf(digests []crypto.Identifier) []crypto.Identifier {
+	if len(digests) == 0 {
+		return nil
+	}
+	return digests
+}
+
 func (b *Block) makeID(nodeID identity.NodeID) {
 	raw := &rawBlock{
 		View:     b.View,
 		QC:       b.QC,
 		Proposer: b.Proposer,
+		Digests:  digestsOf(b.Digests),
 		PrevID:   b.PrevID,
 	}
 	var payloadIDs []string
@@ -71,7 +71,7 @@ func (bc *BlockChain) GetGrandParentBlock(id crypto.Identifier) (*Block, error)
 	return bc.GetParentBlock(parentBlock.ID)
 }
 
-// CommitBlock prunes blocks and returns committed blocks up to the last committed one and prunedBlocks
+// CommitBlock prunes blocks and returns committed blocks up to the last committed one, oldest first, and prunedBlocks
 func (bc *BlockChain) CommitBlock(id crypto.Identifier, view types.View) ([]*Block, []*Block, error) {
 	vertex, ok := bc.forrest.GetVertex(id)
 	if !ok {
@@ -94,6 +94,10 @@ func (bc *BlockChain) CommitBlock(id crypto.Identifier, view types.View) ([]*Blo
 		}
 		block = vertex.GetBlock()
 	}
+	// blocks are collected from the tip, execute them from the oldest
+	for i, j := 0, len(committedBlocks)-1; i < j; i, j = i+1, j-1 {
+		committedBlocks[i], committedBlocks[j] = committedBlocks[j], committedBlocks[i]
+	}
 	forkedBlocks, prunedNo, err := bc.forrest.PruneUpToLevel(uint64(committedView))
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot prune the blockchain to the committed block, id: %w", err)
@@ -0,0 +1,302 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/types"
+)
+
+// kinds of misbehaviour an Evidence proves
+const (
+	EquivocatingProposal = "proposal" // two signed blocks from one proposer in one view
+	EquivocatingVote     = "vote"     // two signed votes from one voter for blocks of one proposer in one view
+)
+
+// Header is a block without its payload, it carries enough to recompute the block id
+type Header struct {
+	types.View
+	QC       *QC
+	Proposer identity.NodeID
+	PrevID   crypto.Identifier
+	TxIDs    []string
+	Digests  []crypto.Identifier
+	Sig      crypto.Signature
+	ID       crypto.Identifier
+}
+
+// Header strips the payload of the block down to the transaction ids
+func (b *Block) Header() *Header {
+	h := &Header{
+		View:     b.View,
+		QC:       b.QC,
+		Proposer: b.Proposer,
+		PrevID:   b.PrevID,
+		Digests:  b.Digests,
+		Sig:      b.Sig,
+		ID:       b.ID,
+	}
+	for _, txn := range b.Payload {
+		h.TxIDs = append(h.TxIDs, txn.ID)
+	}
+	return h
+}
+
+// Verify checks that the id matches the content and is signed by the proposer
+func (h *Header) Verify() error {
+	raw := &rawBlock{
+		View:     h.View,
+		QC:       h.QC,
+		Proposer: h.Proposer,
+		Payload:  h.TxIDs,
+		Digests:  digestsOf(h.Digests),
+		PrevID:   h.PrevID,
+	}
+	if crypto.MakeID(raw) != h.ID {
+		return fmt.Errorf("header does not match id %x", h.ID)
+	}
+	ok, err := crypto.PubVerify(h.Sig, crypto.IDToByte(h.ID), h.Proposer)
+	if err != nil || !ok {
+		return fmt.Errorf("invalid signature of %v on block %x", h.Proposer, h.ID)
+	}
+	return nil
+}
+
+// Evidence proves that a replica signed two conflicting messages,
+// it can be verified by any replica holding the public keys
+type Evidence struct {
+	Kind     string
+	Offender identity.NodeID
+	types.View
+	Headers []*Header // the two conflicting blocks
+	Votes   []*Vote   // the two conflicting votes, only for EquivocatingVote
+}
+
+// Verify checks that the evidence proves the misbehaviour of the offender
+func (e *Evidence) Verify() error {
+	if len(e.Headers) != 2 {
+		return fmt.Errorf("evidence needs two blocks")
+	}
+	for _, h := range e.Headers {
+		if h == nil {
+			return fmt.Errorf("evidence is missing a block")
+		}
+		if err := h.Verify(); err != nil {
+			return err
+		}
+		if h.View != e.View {
+			return fmt.Errorf("block %x is not in view %v", h.ID, e.View)
+		}
+	}
+	if e.Headers[0].ID == e.Headers[1].ID {
+		return fmt.Errorf("blocks are not conflicting")
+	}
+	if e.Headers[0].Proposer != e.Headers[1].Proposer {
+		return fmt.Errorf("blocks are from different proposers")
+	}
+	switch e.Kind {
+	case EquivocatingProposal:
+		if e.Headers[0].Proposer != e.Offender {
+			return fmt.Errorf("blocks are not proposed by %v", e.Offender)
+		}
+	case EquivocatingVote:
+		if len(e.Votes) != 2 {
+			return fmt.Errorf("evidence needs two votes")
+		}
+		for i, vote := range e.Votes {
+			if vote == nil || vote.Voter != e.Offender || vote.BlockID != e.Headers[i].ID {
+				return fmt.Errorf("votes do not match the blocks of %v", e.Offender)
+			}
+			ok, err := crypto.PubVerify(vote.Signature, crypto.IDToByte(vote.BlockID), vote.Voter)
+			if err != nil || !ok {
+				return fmt.Errorf("invalid signature of %v on vote %x", vote.Voter, vote.BlockID)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown kind of evidence %s", e.Kind)
+	}
+	return nil
+}
+
+func (e *Evidence) String() string {
+	return fmt.Sprintf("%s equivocation by %v in view %v: %x and %x", e.Kind, e.Offender, e.View, e.Headers[0].ID, e.Headers[1].ID)
+}
+
+// HeaderRequest asks a voter for the header of a block the requester has not received
+type HeaderRequest struct {
+	types.View
+	BlockID   crypto.Identifier
+	Requester identity.NodeID
+}
+
+// Detector remembers the proposals and votes of recent views and
+// produces evidence when a replica signs two conflicting ones
+type Detector struct {
+	window    types.View // number of views kept
+	highest   types.View
+	headers   map[crypto.Identifier]*Header
+	proposals map[types.View]map[identity.NodeID]*Header
+	votes     map[types.View]map[identity.NodeID][]*Vote
+	requested map[crypto.Identifier]bool
+}
+
+func NewDetector(window types.View) *Detector {
+	return &Detector{
+		window:    window,
+		headers:   make(map[crypto.Identifier]*Header),
+		proposals: make(map[types.View]map[identity.NodeID]*Header),
+		votes:     make(map[types.View]map[identity.NodeID][]*Vote),
+		requested: make(map[crypto.Identifier]bool),
+	}
+}
+
+// AddBlock records the proposal, see AddHeader
+func (d *Detector) AddBlock(block *Block) *Evidence {
+	if _, exists := d.headers[block.ID]; exists {
+		return nil
+	}
+	return d.AddHeader(block.Header())
+}
+
+// AddHeader records a proposal and returns evidence if it conflicts with an earlier one,
+// or if it completes a pair of conflicting votes
+func (d *Detector) AddHeader(h *Header) *Evidence {
+	if h.View+d.window < d.highest {
+		return nil
+	}
+	if _, exists := d.headers[h.ID]; exists {
+		return nil
+	}
+	if h.Verify() != nil {
+		return nil
+	}
+	d.prune(h.View)
+	d.headers[h.ID] = h
+	delete(d.requested, h.ID)
+	proposals, exists := d.proposals[h.View]
+	if !exists {
+		proposals = make(map[identity.NodeID]*Header)
+		d.proposals[h.View] = proposals
+	}
+	first, exists := proposals[h.Proposer]
+	if exists {
+		return &Evidence{
+			Kind:     EquivocatingProposal,
+			Offender: h.Proposer,
+			View:     h.View,
+			Headers:  []*Header{first, h},
+		}
+	}
+	proposals[h.Proposer] = h
+	for voter := range d.votes[h.View] {
+		if ev := d.conflictingVotes(h.View, voter); ev != nil {
+			return ev
+		}
+	}
+	return nil
+}
+
+// AddVote records the vote and returns evidence if the voter voted for a
+// conflicting block in the same view
+func (d *Detector) AddVote(vote *Vote) *Evidence {
+	if vote.View+d.window < d.highest {
+		return nil
+	}
+	d.prune(vote.View)
+	votes, exists := d.votes[vote.View]
+	if !exists {
+		votes = make(map[identity.NodeID][]*Vote)
+		d.votes[vote.View] = votes
+	}
+	for _, v := range votes[vote.Voter] {
+		if v.BlockID == vote.BlockID {
+			return nil
+		}
+	}
+	votes[vote.Voter] = append(votes[vote.Voter], vote)
+	return d.conflictingVotes(vote.View, vote.Voter)
+}
+
+// Header returns the header of a recent block
+func (d *Detector) Header(id crypto.Identifier) (*Header, bool) {
+	h, exists := d.headers[id]
+	return h, exists
+}
+
+// Missing returns the blocks voted for before the view that have not been received,
+// together with a voter to ask for each. Every block is returned once
+func (d *Detector) Missing(view types.View) map[crypto.Identifier]*Vote {
+	missing := make(map[crypto.Identifier]*Vote)
+	for v, votes := range d.votes {
+		if v >= view {
+			continue
+		}
+		for _, vs := range votes {
+			for _, vote := range vs {
+				if _, exists := d.headers[vote.BlockID]; exists || d.requested[vote.BlockID] {
+					continue
+				}
+				d.requested[vote.BlockID] = true
+				missing[vote.BlockID] = vote
+			}
+		}
+	}
+	return missing
+}
+
+// conflictingVotes looks for two votes of the voter on different blocks of one proposer
+func (d *Detector) conflictingVotes(view types.View, voter identity.NodeID) *Evidence {
+	votes := d.votes[view][voter]
+	for i := 0; i < len(votes); i++ {
+		first, ok := d.headers[votes[i].BlockID]
+		if !ok {
+			continue
+		}
+		for j := i + 1; j < len(votes); j++ {
+			second, ok := d.headers[votes[j].BlockID]
+			if !ok || second.Proposer != first.Proposer {
+				continue
+			}
+			ev := &Evidence{
+				Kind:     EquivocatingVote,
+				Offender: voter,
+				View:     view,
+				Headers:  []*Header{first, second},
+				Votes:    []*Vote{votes[i], votes[j]},
+			}
+			if ev.Verify() == nil {
+				return ev
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Detector) prune(view types.View) {
+	if view <= d.highest {
+		return
+	}
+	d.highest = view
+	for id, h := range d.headers {
+		if h.View+d.window < d.highest {
+			delete(d.headers, id)
+		}
+	}
+	for v := range d.proposals {
+		if v+d.window < d.highest {
+			delete(d.proposals, v)
+		}
+	}
+	for v, votes := range d.votes {
+		if v+d.window >= d.highest {
+			continue
+		}
+		for _, vs := range votes {
+			for _, vote := range vs {
+				delete(d.requested, vote.BlockID)
+			}
+		}
+		delete(d.votes, v)
+	}
+}
@@ -0,0 +1,215 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"testing"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	if err := crypto.GenerateKeys(4); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// regob sends v through gob like the network does and decodes it into out
+func regob(t *testing.T, v interface{}, out interface{}) {
+	var buf bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&buf).Encode(v))
+	require.NoError(t, gob.NewDecoder(&buf).Decode(out))
+}
+
+func TestHeaderVerifyGob(t *testing.T) {
+	qc := &QC{View: 1, BlockID: crypto.MakeID("parent")}
+	txns := []*message.Transaction{{ID: "1.1"}, {ID: "1.2"}}
+	for _, block := range []*Block{
+		MakeBlock(2, qc, qc.BlockID, txns, nil, "1"),
+		// an empty but not nil slice of digests is decoded as nil
+		MakeBlock(2, qc, qc.BlockID, txns, []crypto.Identifier{}, "1"),
+		MakeBlock(2, qc, qc.BlockID, nil, []crypto.Identifier{crypto.MakeID("batch")}, "1"),
+		MakeBlock(2, qc, qc.BlockID, nil, nil, "1"),
+	} {
+		var h Header
+		regob(t, block.Header(), &h)
+		require.NoError(t, h.Verify())
+
+		var b Block
+		regob(t, block, &b)
+		require.NoError(t, b.Header().Verify())
+	}
+	require.Equal(t, MakeBlock(2, qc, qc.BlockID, txns, nil, "1").ID, MakeBlock(2, qc, qc.BlockID, txns, []crypto.Identifier{}, "1").ID)
+}
+
+func twins(view types.View, proposer identity.NodeID) (*Block, *Block) {
+	qc := &QC{View: view - 1, BlockID: crypto.MakeID("parent")}
+	txns := []*message.Transaction{{ID: "1.1"}, {ID: "1.2"}}
+	block := MakeBlock(view, qc, qc.BlockID, txns, nil, proposer)
+	twin := MakeBlock(view, qc, qc.BlockID, []*message.Transaction{txns[1], txns[0]}, nil, proposer)
+	return block, twin
+}
+
+func TestHeaderVerifyTampered(t *testing.T) {
+	block, _ := twins(2, "1")
+	h := block.Header()
+	require.NoError(t, h.Verify())
+
+	tampered := *h
+	tampered.TxIDs = []string{"1.1"}
+	require.Error(t, tampered.Verify())
+
+	// signed by another replica than the proposer
+	forged := *h
+	forged.Sig, _ = crypto.PrivSign(crypto.IDToByte(h.ID), "2", nil)
+	require.Error(t, forged.Verify())
+	forged.Sig = nil
+	require.Error(t, forged.Verify())
+}
+
+func TestDetectorProposal(t *testing.T) {
+	d := NewDetector(10)
+	block, twin := twins(2, "1")
+	require.Nil(t, d.AddBlock(block))
+	require.Nil(t, d.AddBlock(block))
+
+	// the twin arrives over the network
+	var h Header
+	regob(t, twin.Header(), &h)
+	ev := d.AddHeader(&h)
+	require.NotNil(t, ev)
+	require.Equal(t, EquivocatingProposal, ev.Kind)
+	require.Equal(t, identity.NodeID("1"), ev.Offender)
+	require.Equal(t, types.View(2), ev.View)
+
+	// the evidence convinces a replica that received it
+	var received Evidence
+	regob(t, ev, &received)
+	require.NoError(t, received.Verify())
+
+	// blocks of other proposers or views are no evidence
+	other, _ := twins(2, "2")
+	require.Nil(t, d.AddBlock(other))
+	later, _ := twins(3, "1")
+	require.Nil(t, d.AddBlock(later))
+}
+
+func TestDetectorIgnoresForgedHeaders(t *testing.T) {
+	d := NewDetector(10)
+	block, twin := twins(2, "1")
+	require.Nil(t, d.AddBlock(block))
+	// a twin not signed by its proposer incriminates nobody
+	h := twin.Header()
+	h.Sig, _ = crypto.PrivSign(crypto.IDToByte(h.ID), "2", nil)
+	require.Nil(t, d.AddHeader(h))
+	_, exists := d.Header(h.ID)
+	require.False(t, exists)
+}
+
+func TestDetectorVote(t *testing.T) {
+	d := NewDetector(10)
+	block, twin := twins(2, "1")
+	require.Nil(t, d.AddVote(MakeVote(2, "3", block.ID)))
+	require.Nil(t, d.AddVote(MakeVote(2, "3", twin.ID)))
+	require.Nil(t, d.AddVote(MakeVote(2, "3", twin.ID)))
+
+	// the blocks voted for are only known after the votes
+	require.Nil(t, d.AddBlock(block))
+	require.Equal(t, map[crypto.Identifier]*Vote{}, d.Missing(2))
+	missing := d.Missing(3)
+	require.Len(t, missing, 1)
+	require.Equal(t, twin.ID, missing[twin.ID].BlockID)
+	var h Header
+	regob(t, twin.Header(), &h)
+	ev := d.AddHeader(&h)
+	// the proposer equivocated too, its evidence comes first
+	require.NotNil(t, ev)
+	require.Equal(t, EquivocatingProposal, ev.Kind)
+
+	d = NewDetector(10)
+	require.Nil(t, d.AddHeader(block.Header()))
+	require.Nil(t, d.AddVote(MakeVote(2, "3", block.ID)))
+	vote := MakeVote(2, "3", twin.ID)
+	require.Nil(t, d.AddVote(vote))
+	ev = d.conflictingVotes(2, "3")
+	require.Nil(t, ev, "the twin is unknown")
+
+	// votes for blocks of different proposers are no evidence
+	other, _ := twins(2, "2")
+	require.Nil(t, d.AddHeader(other.Header()))
+	require.Nil(t, d.AddVote(MakeVote(2, "3", other.ID)))
+}
+
+func TestDetectorVoteEvidence(t *testing.T) {
+	block, twin := twins(2, "1")
+	ev := &Evidence{
+		Kind:     EquivocatingVote,
+		Offender: "3",
+		View:     2,
+		Headers:  []*Header{block.Header(), twin.Header()},
+		Votes:    []*Vote{MakeVote(2, "3", block.ID), MakeVote(2, "3", twin.ID)},
+	}
+	var received Evidence
+	regob(t, ev, &received)
+	require.NoError(t, received.Verify())
+
+	// a detector holding both headers turns the second vote into the evidence
+	d := NewDetector(10)
+	d.headers[block.ID] = block.Header()
+	d.headers[twin.ID] = twin.Header()
+	require.Nil(t, d.AddVote(ev.Votes[0]))
+	found := d.AddVote(ev.Votes[1])
+	require.NotNil(t, found)
+	require.Equal(t, EquivocatingVote, found.Kind)
+	require.Equal(t, identity.NodeID("3"), found.Offender)
+	require.NoError(t, found.Verify())
+}
+
+func TestForgedEvidence(t *testing.T) {
+	block, twin := twins(2, "1")
+	valid := func() *Evidence {
+		return &Evidence{
+			Kind:     EquivocatingVote,
+			Offender: "3",
+			View:     2,
+			Headers:  []*Header{block.Header(), twin.Header()},
+			Votes:    []*Vote{MakeVote(2, "3", block.ID), MakeVote(2, "3", twin.ID)},
+		}
+	}
+	require.NoError(t, valid().Verify())
+
+	for name, forge := range map[string]func(ev *Evidence){
+		"one block":    func(ev *Evidence) { ev.Headers = ev.Headers[:1] },
+		"same block":   func(ev *Evidence) { ev.Headers[1] = ev.Headers[0]; ev.Votes[1] = ev.Votes[0] },
+		"other view":   func(ev *Evidence) { ev.View = 3 },
+		"unknown kind": func(ev *Evidence) { ev.Kind = "gossip" },
+		"no votes":     func(ev *Evidence) { ev.Votes = nil },
+		"other voter":  func(ev *Evidence) { ev.Offender = "4" },
+		"tampered block": func(ev *Evidence) {
+			h := *ev.Headers[1]
+			h.TxIDs = nil
+			ev.Headers[1] = &h
+		},
+		"forged vote": func(ev *Evidence) {
+			v := *ev.Votes[1]
+			v.Signature, _ = crypto.PrivSign(crypto.IDToByte(v.BlockID), "4", nil)
+			ev.Votes[1] = &v
+		},
+		"different proposers": func(ev *Evidence) {
+			other, _ := twins(2, "2")
+			ev.Headers[1] = other.Header()
+			ev.Votes[1] = MakeVote(2, "3", other.ID)
+		},
+		"framed proposer": func(ev *Evidence) { ev.Kind = EquivocatingProposal },
+	} {
+		ev := valid()
+		forge(ev)
+		require.Error(t, ev.Verify(), name)
+	}
+}
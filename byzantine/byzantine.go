@@ -0,0 +1,46 @@
+package byzantine
+
+import (
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+// Byzantine hooks the points where a replica can deviate from the protocol.
+// Strategies only rewrite the messages a replica sends and filter the ones it
+// receives, so new attacks can be added without touching consensus code.
+type Byzantine interface {
+	// Propose returns the proposals each replica in ids receives, including the proposer itself
+	Propose(block *blockchain.Block, ids []identity.NodeID) map[identity.NodeID][]*blockchain.Block
+	// ShouldVote decides whether the replica votes for block, safe is the decision of the voting rule
+	ShouldVote(block *blockchain.Block, safe bool) bool
+	// Vote returns the votes sent in place of vote
+	Vote(vote *blockchain.Vote) []*blockchain.Vote
+	// Timeout returns the timeout message broadcast in place of tmo, nil withholds it
+	Timeout(tmo *pacemaker.TMO) *pacemaker.TMO
+	// Forward reports whether a message received from the network is passed on to the protocol
+	Forward(m interface{}) bool
+}
+
+var strategies = make(map[string]func(id identity.NodeID) Byzantine)
+
+// Register makes a strategy available by name, it is meant to be called from init()
+func Register(name string, f func(id identity.NodeID) Byzantine) {
+	if _, exists := strategies[name]; exists {
+		log.Fatalf("strategy %s is registered twice", name)
+	}
+	strategies[name] = f
+}
+
+// New creates the strategy registered under name for node id, an empty name is honest
+func New(name string, id identity.NodeID) Byzantine {
+	if name == "" {
+		name = HONEST
+	}
+	f, exists := strategies[name]
+	if !exists {
+		log.Fatalf("unknown Byzantine strategy %s", name)
+	}
+	return f(id)
+}
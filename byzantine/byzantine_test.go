@@ -0,0 +1,90 @@
+package byzantine
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/pacemaker"
+	"github.com/gitferry/bamboo/types"
+	"github.com/stretchr/testify/require"
+)
+
+var ids = []identity.NodeID{"1", "2", "3", "4"}
+
+func TestMain(m *testing.M) {
+	if err := crypto.GenerateKeys(len(ids)); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+func proposal(view int, qc *blockchain.QC, n int) *blockchain.Block {
+	payload := make([]*message.Transaction, n)
+	for i := range payload {
+		payload[i] = &message.Transaction{ID: string(rune('a' + i)), Command: db.Command{Key: db.Key(i)}}
+	}
+	return blockchain.MakeBlock(types.View(view), qc, qc.BlockID, payload, nil, "1")
+}
+
+func TestFork(t *testing.T) {
+	defer func(c config.Config) { config.Configuration = c }(config.Configuration)
+	config.Configuration.Strategies = map[identity.NodeID]string{"1": FORK, "4": DOUBLEVOTE}
+
+	qc := &blockchain.QC{View: 1, BlockID: crypto.MakeID("parent")}
+	block := proposal(2, qc, 2)
+	proposals := New(FORK, "1").Propose(block, ids)
+
+	require.Equal(t, []*blockchain.Block{block}, proposals["1"])
+	require.Equal(t, []*blockchain.Block{block}, proposals["2"])
+	require.Len(t, proposals["3"], 1)
+	twin := proposals["3"][0]
+	require.NotEqual(t, block.ID, twin.ID)
+	require.Equal(t, block.View, twin.View)
+	require.Equal(t, block.PrevID, twin.PrevID)
+	require.Len(t, twin.Payload, 2)
+	// the Byzantine peer gets both
+	require.Equal(t, []*blockchain.Block{block, twin}, proposals["4"])
+
+	// an empty block cannot be equivocated on
+	empty := proposal(3, qc, 0)
+	for _, id := range ids {
+		require.Equal(t, []*blockchain.Block{empty}, New(FORK, "1").Propose(empty, ids)[id])
+	}
+}
+
+func TestDoubleVote(t *testing.T) {
+	block := proposal(2, &blockchain.QC{View: 1}, 1)
+	require.True(t, New(DOUBLEVOTE, "1").ShouldVote(block, false))
+	require.False(t, New(HONEST, "1").ShouldVote(block, false))
+	require.False(t, New(SILENCE, "1").ShouldVote(block, true))
+
+	vote := blockchain.MakeVote(2, "1", block.ID)
+	require.Equal(t, []*blockchain.Vote{vote}, New(DOUBLEVOTE, "1").Vote(vote))
+}
+
+func TestStaleQC(t *testing.T) {
+	s := New(STALEQC, "1")
+	qcs := make([]*blockchain.QC, 4)
+	for i := range qcs {
+		qcs[i] = &blockchain.QC{View: types.View(i + 1), BlockID: crypto.MakeID(i)}
+	}
+
+	// no lower qc is known yet
+	block := proposal(3, qcs[1], 1)
+	require.Equal(t, block, s.Propose(block, ids)["2"][0])
+
+	require.True(t, s.Forward(*proposal(2, qcs[0], 1)))
+	require.True(t, s.Forward(pacemaker.TMO{View: 3, HighQC: qcs[2]}))
+	block = proposal(5, qcs[3], 1)
+	stale := s.Propose(block, ids)["2"][0]
+	require.Equal(t, qcs[2], stale.QC)
+	require.Equal(t, qcs[2].BlockID, stale.PrevID)
+	require.Equal(t, block.View, stale.View)
+	require.Equal(t, block.Payload, stale.Payload)
+}
@@ -0,0 +1,23 @@
+package byzantine
+
+import (
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+)
+
+const DOUBLEVOTE = "double-vote"
+
+func init() {
+	Register(DOUBLEVOTE, func(id identity.NodeID) Byzantine { return DoubleVote{} })
+}
+
+// DoubleVote votes for every block it receives in a view, including the
+// conflicting ones an honest replica refuses to vote for
+type DoubleVote struct {
+	Honest
+}
+
+// ShouldVote votes for every block, the voting rule is ignored
+func (DoubleVote) ShouldVote(block *blockchain.Block, safe bool) bool {
+	return true
+}
@@ -0,0 +1,68 @@
+package byzantine
+
+import (
+	"sort"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
+)
+
+const FORK = "fork"
+
+func init() {
+	Register(FORK, func(id identity.NodeID) Byzantine { return &Fork{id: id} })
+}
+
+// Fork sends its proposal to one half of the committee and a conflicting
+// proposal for the same view to the other half, Byzantine peers receive both
+type Fork struct {
+	Honest
+	id identity.NodeID
+}
+
+func (f *Fork) Propose(block *blockchain.Block, ids []identity.NodeID) map[identity.NodeID][]*blockchain.Block {
+	if len(block.Payload) == 0 && len(block.Digests) == 0 {
+		log.Debugf("[%v] cannot equivocate on an empty block, view: %v", f.id, block.View)
+		return f.Honest.Propose(block, ids)
+	}
+	// reversing the payload changes the block id without dropping transactions,
+	// the twin of a single-transaction block is left empty instead
+	payload := make([]*message.Transaction, 0, len(block.Payload))
+	if len(block.Payload) > 1 {
+		for i := len(block.Payload) - 1; i >= 0; i-- {
+			payload = append(payload, block.Payload[i])
+		}
+	}
+	// batches are reversed alike
+	var digests []crypto.Identifier
+	if len(block.Digests) > 1 {
+		for i := len(block.Digests) - 1; i >= 0; i-- {
+			digests = append(digests, block.Digests[i])
+		}
+	}
+	twin := blockchain.MakeBlock(block.View, block.QC, block.PrevID, payload, digests, f.id)
+	twin.Timestamp = block.Timestamp
+
+	sorted := make([]identity.NodeID, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Node() < sorted[j].Node() })
+	proposals := make(map[identity.NodeID][]*blockchain.Block, len(sorted))
+	for i, id := range sorted {
+		switch {
+		case id == f.id:
+			proposals[id] = []*blockchain.Block{block}
+		case config.GetConfig().IsByzantine(id):
+			proposals[id] = []*blockchain.Block{block, twin}
+		case i < len(sorted)/2:
+			proposals[id] = []*blockchain.Block{block}
+		default:
+			proposals[id] = []*blockchain.Block{twin}
+		}
+	}
+	log.Infof("[%v] equivocated in view %v, id: %x, twin id: %x", f.id, block.View, block.ID, twin.ID)
+	return proposals
+}
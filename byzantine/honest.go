@@ -0,0 +1,40 @@
+package byzantine
+
+import (
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+const HONEST = "honest"
+
+func init() {
+	Register(HONEST, func(id identity.NodeID) Byzantine { return Honest{} })
+}
+
+// Honest follows the protocol, other strategies embed it to override only some hooks
+type Honest struct{}
+
+func (Honest) Propose(block *blockchain.Block, ids []identity.NodeID) map[identity.NodeID][]*blockchain.Block {
+	proposals := make(map[identity.NodeID][]*blockchain.Block, len(ids))
+	for _, id := range ids {
+		proposals[id] = []*blockchain.Block{block}
+	}
+	return proposals
+}
+
+func (Honest) ShouldVote(block *blockchain.Block, safe bool) bool {
+	return safe
+}
+
+func (Honest) Vote(vote *blockchain.Vote) []*blockchain.Vote {
+	return []*blockchain.Vote{vote}
+}
+
+func (Honest) Timeout(tmo *pacemaker.TMO) *pacemaker.TMO {
+	return tmo
+}
+
+func (Honest) Forward(m interface{}) bool {
+	return true
+}
@@ -0,0 +1,36 @@
+package byzantine
+
+import (
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+const SILENCE = "silence"
+
+func init() {
+	Register(SILENCE, func(id identity.NodeID) Byzantine { return Silence{} })
+}
+
+// Silence neither sends nor processes any protocol message
+type Silence struct{}
+
+func (Silence) Propose(block *blockchain.Block, ids []identity.NodeID) map[identity.NodeID][]*blockchain.Block {
+	return nil
+}
+
+func (Silence) ShouldVote(block *blockchain.Block, safe bool) bool {
+	return false
+}
+
+func (Silence) Vote(vote *blockchain.Vote) []*blockchain.Vote {
+	return nil
+}
+
+func (Silence) Timeout(tmo *pacemaker.TMO) *pacemaker.TMO {
+	return nil
+}
+
+func (Silence) Forward(m interface{}) bool {
+	return false
+}
@@ -0,0 +1,71 @@
+package byzantine
+
+import (
+	"sync"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+const STALEQC = "stale-qc"
+
+func init() {
+	Register(STALEQC, func(id identity.NodeID) Byzantine { return &StaleQC{id: id} })
+}
+
+// StaleQC proposes on the highest QC it has seen below the one the protocol
+// picked, so that its block forks off the latest certified block
+type StaleQC struct {
+	Honest
+	id  identity.NodeID
+	qcs [2]*blockchain.QC // the two highest QCs seen, ordered by view
+	mu  sync.Mutex
+}
+
+func (s *StaleQC) Propose(block *blockchain.Block, ids []identity.NodeID) map[identity.NodeID][]*blockchain.Block {
+	qc := s.staleQC(block.QC)
+	if qc == nil {
+		return s.Honest.Propose(block, ids)
+	}
+	stale := blockchain.MakeBlock(block.View, qc, qc.BlockID, block.Payload, block.Digests, s.id)
+	stale.Timestamp = block.Timestamp
+	log.Debugf("[%v] proposes on a stale qc, view: %v, qc view: %v", s.id, block.View, qc.View)
+	return s.Honest.Propose(stale, ids)
+}
+
+func (s *StaleQC) Forward(m interface{}) bool {
+	switch m := m.(type) {
+	case blockchain.Block:
+		s.observe(m.QC)
+	case pacemaker.TMO:
+		s.observe(m.HighQC)
+	}
+	return true
+}
+
+func (s *StaleQC) observe(qc *blockchain.QC) {
+	if qc == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.qcs[1] == nil || qc.View > s.qcs[1].View:
+		s.qcs[0], s.qcs[1] = s.qcs[1], qc
+	case qc.View < s.qcs[1].View && (s.qcs[0] == nil || qc.View > s.qcs[0].View):
+		s.qcs[0] = qc
+	}
+}
+
+func (s *StaleQC) staleQC(current *blockchain.QC) *blockchain.QC {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.qcs) - 1; i >= 0; i-- {
+		if s.qcs[i] != nil && s.qcs[i].View < current.View {
+			return s.qcs[i]
+		}
+	}
+	return nil
+}
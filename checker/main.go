@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gitferry/bamboo"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
+)
+
+var interval = flag.Duration("interval", time.Second, "interval between two polls of the replicas")
+var duration = flag.Duration("duration", 0, "stop after the duration, 0 checks until interrupted")
+
+// checker polls the committed chain of every replica and reports a fork
+// whenever two replicas committed different blocks at the same height
+type checker struct {
+	client *bamboo.HTTPClient
+	next   map[identity.NodeID]int // next height to fetch from each replica
+	chain  map[int]message.CommittedBlock
+	owner  map[int]identity.NodeID // the replica the block at each height was first seen on
+	forks  int
+}
+
+func newChecker() *checker {
+	c := &checker{
+		client: bamboo.NewHTTPClient(),
+		next:   make(map[identity.NodeID]int),
+		chain:  make(map[int]message.CommittedBlock),
+		owner:  make(map[int]identity.NodeID),
+	}
+	for id := range c.client.HTTP {
+		c.next[id] = 0
+	}
+	return c
+}
+
+func (c *checker) poll() {
+	for id := range c.next {
+		blocks, err := c.client.Committed(id, c.next[id])
+		if err != nil {
+			log.Warningf("cannot poll replica %v: %v", id, err)
+			continue
+		}
+		for _, block := range blocks {
+			c.check(id, block)
+		}
+		c.next[id] += len(blocks)
+	}
+	c.prune()
+}
+
+func (c *checker) check(id identity.NodeID, block message.CommittedBlock) {
+	seen, exists := c.chain[block.Height]
+	if !exists {
+		c.chain[block.Height] = block
+		c.owner[block.Height] = id
+		return
+	}
+	if seen.ID == block.ID {
+		return
+	}
+	c.forks++
+	msg := fmt.Sprintf("fork at height %v: replica %v committed %s in view %v, replica %v committed %s in view %v",
+		block.Height, c.owner[block.Height], seen.ID, seen.View, id, block.ID, block.View)
+	log.Error(msg)
+	fmt.Println(msg)
+}
+
+// prune forgets the heights every replica has been checked at
+func (c *checker) prune() {
+	low := -1
+	for _, next := range c.next {
+		if low < 0 || next < low {
+			low = next
+		}
+	}
+	for height := range c.chain {
+		if height < low {
+			delete(c.chain, height)
+			delete(c.owner, height)
+		}
+	}
+	log.Infof("checked all replicas up to height %v, forks found: %v", low, c.forks)
+}
+
+func main() {
+	bamboo.Init()
+
+	c := newChecker()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	var timeout <-chan time.Time
+	if *duration > 0 {
+		timeout = time.After(*duration)
+	}
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+L:
+	for {
+		select {
+		case <-ticker.C:
+			c.poll()
+		case <-timeout:
+			break L
+		case <-stop:
+			break L
+		}
+	}
+	c.poll()
+	fmt.Printf("checked %v replicas, forks found: %v\n", len(c.next), c.forks)
+	if c.forks > 0 {
+		os.Exit(1)
+	}
+}
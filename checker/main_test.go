@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+// chain is the committed chain a fake replica serves on /committed
+type chain struct {
+	mu     sync.Mutex
+	blocks []message.CommittedBlock
+}
+
+func (c *chain) commit(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		c.blocks = append(c.blocks, message.CommittedBlock{Height: len(c.blocks), ID: id})
+	}
+}
+
+func (c *chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	if from > len(c.blocks) {
+		from = len(c.blocks)
+	}
+	json.NewEncoder(w).Encode(c.blocks[from:])
+}
+
+// newTestChecker returns a checker polling a fake replica for each chain
+func newTestChecker(t *testing.T, chains ...*chain) *checker {
+	c := config.Configuration
+	t.Cleanup(func() { config.Configuration = c })
+	config.Configuration.Addrs = make(map[identity.NodeID]string)
+	config.Configuration.HTTPAddrs = make(map[identity.NodeID]string)
+	for i, ch := range chains {
+		server := httptest.NewServer(ch)
+		t.Cleanup(server.Close)
+		id := identity.NewNodeID(i + 1)
+		config.Configuration.Addrs[id] = server.URL
+		config.Configuration.HTTPAddrs[id] = server.URL
+	}
+	return newChecker()
+}
+
+func TestCheckerConsistent(t *testing.T) {
+	a, b := new(chain), new(chain)
+	c := newTestChecker(t, a, b)
+
+	a.commit("x", "y", "z")
+	b.commit("x")
+	c.poll()
+	// the heights only one replica reached are kept until the other catches up
+	require.Len(t, c.chain, 2)
+	b.commit("y", "z")
+	c.poll()
+	require.Equal(t, 0, c.forks)
+	require.Empty(t, c.chain)
+	for _, next := range c.next {
+		require.Equal(t, 3, next)
+	}
+}
+
+func TestCheckerFork(t *testing.T) {
+	a, b := new(chain), new(chain)
+	c := newTestChecker(t, a, b)
+
+	a.commit("x", "y")
+	b.commit("x", "w")
+	c.poll()
+	require.Equal(t, 1, c.forks)
+
+	// a fork is reported once, the chains are checked on from the next height
+	a.commit("z")
+	b.commit("z")
+	c.poll()
+	require.Equal(t, 1, c.forks)
+}
@@ -2,19 +2,25 @@ package bamboo
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httputil"
 	"strconv"
 	"sync"
+	"time"
 
+	"github.com/gitferry/bamboo/byzantine"
 	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
 	"github.com/gitferry/bamboo/db"
 	"github.com/gitferry/bamboo/identity"
 	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
 	"github.com/gitferry/bamboo/node"
 )
 
@@ -32,6 +38,9 @@ type AdminClient interface {
 	Partition(int, ...identity.NodeID)
 }
 
+// retryDelay is the wait before the first retry of a command, it grows with every retry
+const retryDelay = 10 * time.Millisecond
+
 // HTTPClient implements Client interface with REST API
 type HTTPClient struct {
 	Addrs map[identity.NodeID]string
@@ -41,6 +50,10 @@ type HTTPClient struct {
 
 	CID int // command id
 	*http.Client
+
+	Key crypto.PrivateKey // signs the commands if set, the client id is then the one of the key
+
+	mu sync.Mutex // guards CID
 }
 
 // NewHTTPClient creates a new Client from config
@@ -49,48 +62,92 @@ func NewHTTPClient() *HTTPClient {
 		N:      len(config.Configuration.Addrs),
 		Addrs:  config.Configuration.Addrs,
 		HTTP:   config.Configuration.HTTPAddrs,
-		Client: &http.Client{},
+		Client: &http.Client{Timeout: time.Duration(config.GetConfig().RequestTimeout) * time.Millisecond},
 	}
-	// will not send request to Byzantine nodes
-	bzn := config.GetConfig().ByzNo
-	if config.GetConfig().Strategy == "silence" {
-		for i := 1; i <= bzn; i++ {
-			id := identity.NewNodeID(i)
+	// will not send request to silent nodes
+	for id := range config.Configuration.Addrs {
+		if config.GetConfig().StrategyOf(id) == byzantine.SILENCE {
 			delete(c.Addrs, id)
 			delete(c.HTTP, id)
 		}
 	}
+	if config.GetConfig().SignedTxs {
+		key, err := crypto.NewClientKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Key = key
+		c.ID = crypto.KeyID(crypto.EncodePublicKey(key.PublicKey()))
+	}
 	return c
 }
 
+// sign returns the hex of the public key and the signature of the command and fee, both are empty
+// if the client has no key
+func (c *HTTPClient) sign(cmd db.Command, fee string) (string, string, error) {
+	if c.Key == nil {
+		return "", "", nil
+	}
+	txn := message.Transaction{Command: cmd}
+	if fee != "" {
+		txn.Properties = map[string]string{message.FeeProperty: fee}
+	}
+	if err := txn.Sign(c.Key); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(txn.PubKey), crypto.EncodeSignature(txn.Sig), nil
+}
+
+// nextCID returns a new command id, commands are identified by client id and command id
+func (c *HTTPClient) nextCID() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.CID++
+	return c.CID
+}
+
 // Get gets value of given key (use REST)
 // Default implementation of Client interface
 func (c *HTTPClient) Get(key db.Key) (string, error) {
-	c.CID++
-	//v, _, err := c.RESTGet(key)
-	//return v, err
-	return "", nil
+	v, err := c.RESTGet(key)
+	return string(v), err
 }
 
 // Put puts new key value pair and return previous value (use REST)
 // Default implementation of Client interface
 func (c *HTTPClient) Put(key db.Key, value db.Value) error {
-	c.CID++
 	return c.RESTPut(key, value)
 }
 
-//func (c *HTTPClient) GetURL(key db.Key) (identity.NodeID, string) {
-//	replicaID := config.GetConfig().Master
-//	if replicaID == "0" {
-//		keys := reflect.ValueOf(c.HTTP).MapKeys()
-//		replicaID = keys[rand.Intn(len(keys))].Interface().(identity.NodeID)
-//	}
-//	return replicaID, c.HTTP[replicaID] + "/" + strconv.Itoa(int(key))
-//}
+// GetURL picks a random replica to send the request of the key to
+func (c *HTTPClient) GetURL(key db.Key) (identity.NodeID, string) {
+	i := rand.Intn(len(c.HTTP))
+	for id, url := range c.HTTP {
+		if i == 0 {
+			return id, url + "/" + strconv.Itoa(int(key))
+		}
+		i--
+	}
+	return "", ""
+}
 
 // rest accesses server's REST API with url = http://ip:port/key
-// if value == nil, it's a read
-func (c *HTTPClient) rest(url string, value db.Value) error {
+// if value == nil, it's a read. A request that times out or meets an overloaded replica is
+// sent again with the same command id, the replicas execute the command once and answer
+// the retry with the first reply
+func (c *HTTPClient) rest(url string, key db.Key, value db.Value, cid int) (db.Value, error) {
+	for i := 0; ; i++ {
+		v, retry, err := c.request(url, key, value, cid)
+		if !retry || i >= config.GetConfig().Retries {
+			return v, err
+		}
+		log.Debugf("client %v retries command %v: %v", c.ID, cid, err)
+		time.Sleep(time.Duration(i+1) * retryDelay)
+	}
+}
+
+// request sends the command once, it returns whether the command may be retried on failure
+func (c *HTTPClient) request(url string, key db.Key, value db.Value, cid int) (db.Value, bool, error) {
 	method := http.MethodGet
 	var body io.Reader
 	if value != nil {
@@ -102,38 +159,56 @@ func (c *HTTPClient) rest(url string, value db.Value) error {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		log.Error(err)
-		return err
+		return nil, false, err
 	}
 	req.Header.Set(node.HTTPClientID, string(c.ID))
-	req.Header.Set(node.HTTPCommandID, strconv.Itoa(c.CID))
+	req.Header.Set(node.HTTPCommandID, strconv.Itoa(cid))
+	if c.Key != nil {
+		pub, sig, err := c.sign(db.Command{Key: key, Value: value, ClientID: c.ID, CommandID: cid}, "")
+		if err != nil {
+			log.Error(err)
+			return nil, false, err
+		}
+		req.Header.Set(node.HTTPPubKey, pub)
+		req.Header.Set(node.HTTPSignature, sig)
+	}
 	req.Header.Set("Connection", "keep-alive")
 	//log.Debugf("The payload is %x",)
 
 	rep, err := c.Client.Do(req)
 	if err != nil {
 		log.Error(err)
-		return err
+		return nil, true, err
 	}
 	defer rep.Body.Close()
 
 	if rep.StatusCode == http.StatusOK {
-		return nil
+		v, err := ioutil.ReadAll(rep.Body)
+		return v, err != nil, err
 	}
 
 	// http call failed
 	dump, _ := httputil.DumpResponse(rep, true)
 	log.Debugf("%q", dump)
-	return errors.New(rep.Status)
+	retry := rep.StatusCode == http.StatusServiceUnavailable || rep.StatusCode == http.StatusGatewayTimeout
+	return nil, retry, errors.New(rep.Status)
 }
 
-// RESTGet issues a http call to node and return value and headers
-//func (c *HTTPClient) RESTGet(key db.Key) (string, error) {
-//	return c.rest(key, nil)
-//}
+// RESTGet reads the value of the key through one replica, the read is ordered by consensus
+func (c *HTTPClient) RESTGet(key db.Key) (db.Value, error) {
+	_, url := c.GetURL(key)
+	return c.rest(url, key, nil, c.nextCID())
+}
 
-// RESTPut puts new value as http.request body and return previous value
+// RESTPut puts new value as http.request body and return previous value, the write is sent to
+// one replica when the replicas gossip transactions and to all of them otherwise
 func (c *HTTPClient) RESTPut(key db.Key, value db.Value) error {
-	return c.AllPut(key, value)
+	if !config.GetConfig().Gossip {
+		return c.AllPut(key, value)
+	}
+	_, url := c.GetURL(key)
+	_, err := c.rest(url, key, value, c.nextCID())
+	return err
 }
 
 func (c *HTTPClient) json(id identity.NodeID, key db.Key, value db.Value) (db.Value, error) {
@@ -142,7 +217,7 @@ func (c *HTTPClient) json(id identity.NodeID, key db.Key, value db.Value) (db.Va
 		Key:       key,
 		Value:     value,
 		ClientID:  c.ID,
-		CommandID: c.CID,
+		CommandID: c.nextCID(),
 	}
 	data, err := json.Marshal(cmd)
 	res, err := c.Client.Post(url, "json", bytes.NewBuffer(data))
@@ -206,20 +281,34 @@ func (c *HTTPClient) JSONPut(key db.Key, value db.Value) (db.Value, error) {
 //	return values, metas
 //}
 
-// QuorumPut concurrently write values to majority of nodes
+// AllPut concurrently writes the value to all nodes, the command is
+// the same at every node and is executed once, so the write succeeds if
+// any node acknowledges its commitment
 // TODO get headers
 func (c *HTTPClient) AllPut(key db.Key, value db.Value) error {
 	var wait sync.WaitGroup
+	var mu sync.Mutex
 	var err error
-	for id, ip := range c.HTTP {
+	acked := false
+	cid := c.nextCID()
+	for _, ip := range c.HTTP {
 		wait.Add(1)
-		go func(id int, ip string) {
-			url := ip + "/" + strconv.Itoa(int(key)+id)
-			err = c.rest(url, value)
-			wait.Done()
-		}(id.Node(), ip)
+		go func(ip string) {
+			defer wait.Done()
+			_, e := c.rest(ip+"/"+strconv.Itoa(int(key)), key, value, cid)
+			mu.Lock()
+			if e != nil {
+				err = e
+			} else {
+				acked = true
+			}
+			mu.Unlock()
+		}(ip)
 	}
 	wait.Wait()
+	if acked {
+		return nil
+	}
 	return err
 }
 
@@ -267,6 +356,21 @@ func (c *HTTPClient) Consensus(k db.Key) bool {
 	return true
 }
 
+// Committed collects the blocks committed by the node from the given height on
+func (c *HTTPClient) Committed(id identity.NodeID, from int) ([]message.CommittedBlock, error) {
+	r, err := c.Client.Get(c.HTTP[id] + "/committed?from=" + strconv.Itoa(from))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, errors.New(r.Status)
+	}
+	var blocks []message.CommittedBlock
+	err = json.NewDecoder(r.Body).Decode(&blocks)
+	return blocks, err
+}
+
 // Crash stops the node for t seconds then recover
 // node crash forever if t < 0
 func (c *HTTPClient) Crash(id identity.NodeID, t int) {
@@ -1,11 +1,27 @@
 package main
 
 import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/gitferry/bamboo"
 	"github.com/gitferry/bamboo/benchmark"
+	"github.com/gitferry/bamboo/config"
 	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
 )
 
+var id = flag.String("id", "", "client id that tells apart the commands of the clients, defaults to the process id")
+var record = flag.String("record", "", "file to record the generated requests to")
+var replay = flag.String("replay", "", "trace file recorded with -record to reissue instead of generating requests")
+var agent = flag.String("agent", "", "run as a benchmark agent listening for the coordinator on the address, e.g. :8090")
+var agents = flag.String("agents", "", "coordinate the comma separated agent urls, e.g. http://10.0.0.2:8090, instead of running a benchmark")
+var report = flag.String("report", "report", "path of the aggregated report written by the coordinator, as .json and .csv")
+
 // Database implements bamboo.DB interface for benchmarking
 type Database struct {
 	bamboo.Client
@@ -19,6 +35,12 @@ func (d *Database) Stop() error {
 	return nil
 }
 
+func (d *Database) Read(k int) ([]byte, error) {
+	key := db.Key(k)
+	v, err := d.Get(key)
+	return []byte(v), err
+}
+
 func (d *Database) Write(k int, v []byte) error {
 	key := db.Key(k)
 	err := d.Put(key, v)
@@ -28,8 +50,54 @@ func (d *Database) Write(k int, v []byte) error {
 func main() {
 	bamboo.Init()
 
+	if *agents != "" {
+		coordinate()
+		return
+	}
+
+	c := bamboo.NewHTTPClient()
+	// a signing client is identified by its key
+	if c.Key == nil {
+		c.ID = identity.NodeID(*id)
+		if c.ID == "" {
+			c.ID = identity.NodeID(strconv.Itoa(os.Getpid()))
+		}
+	}
 	d := new(Database)
-	d.Client = bamboo.NewHTTPClient()
-	b := benchmark.NewBenchmark(d)
-	b.Run()
+	d.Client = c
+	bench := func() *benchmark.Benchmark {
+		b := benchmark.NewBenchmark(d)
+		if *record != "" {
+			if err := b.Record(*record); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *replay != "" {
+			if err := b.Replay(*replay); err != nil {
+				log.Fatal(err)
+			}
+		}
+		return b
+	}
+	if *agent != "" {
+		log.Fatal(benchmark.NewAgent(string(c.ID), bench).Serve(*agent))
+	}
+	bench().Run()
+}
+
+// coordinate runs the benchmark on all agents at the same time and writes the aggregated report
+func coordinate() {
+	co := benchmark.NewCoordinator(strings.Split(*agents, ","))
+	if t := config.GetConfig().Benchmark.T; t > 0 {
+		// the agents drain the operations in flight for a while after T
+		co.Timeout = co.Delay + time.Duration(t)*time.Second + time.Minute
+	}
+	r, err := co.Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Throughput = %f, median = %fms, p99 = %fms", r.Total.Throughput, r.Total.Median, r.Total.P99)
+	if err := r.WriteFile(*report); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -43,9 +43,43 @@ type Config struct {
 	Delay          int             `json:"delay"`        // transmission delay in ms
 	DErr           int             `json:"derr"`         // the err taken into delays
 	MemSize        int             `json:"memsize"`      //交易池大小
+	MemPolicy      string          `json:"mempolicy"`    // ordering of the mempool: fifo, priority or fair
+	Gossip         bool            `json:"gossip"`       // relay new transactions to the mempools of all replicas
+	GossipBatch    int             `json:"gossip_batch"` // transactions per relayed batch
+	GossipDelay    int             `json:"gossip_delay"` // ms a partial batch waits before it is relayed
+	Workers        bool            `json:"workers"`      // disseminate batches ahead of the proposals, blocks carry their digests
+	WorkerBatch    int             `json:"worker_batch"` // transactions per disseminated batch
+	WorkerDelay    int             `json:"worker_delay"` // ms between sealing batches from the mempool
 	Slow           int             `json:"slow"`
 	Crash          int             `json:"crash"`
 
+	// size of the blocks, adaptive batching bounds it by bsize
+	Batching      string `json:"batching"`       // block size policy: fixed (bsize) or adaptive
+	TargetBytes   int    `json:"target_bytes"`   // payload bytes an adaptive block is filled up to, no limit if 0
+	TargetLatency int    `json:"target_latency"` // ms of a view above which adaptive blocks shrink, no adaptation if 0
+	FillTimeout   int    `json:"fill_timeout"`   // ms an adaptive block below its limit waits to fill up
+
+	// byte limits of the payload, no limit if 0
+	MaxTxBytes    int `json:"max_tx_bytes"`    // of a transaction, requests with larger bodies are rejected
+	MemBytes      int `json:"membytes"`        // of the transactions in the mempool
+	MaxBlockBytes int `json:"max_block_bytes"` // of a block or batch, larger proposals are dropped
+
+	// limits of a /batch request, no limit if 0
+	MaxBatch      int `json:"max_batch"`       // submissions, also of a /stream waiting for their acks
+	MaxBatchBytes int `json:"max_batch_bytes"` // bytes of the request body
+
+	SignedTxs bool `json:"signed_txs"` // clients sign their transactions, unsigned or forged ones are rejected
+
+	// client sessions, a command is executed once per client and command id
+	SessionWindow  int `json:"session_window"`  // replies cached per client, older commands are not executed
+	SessionIdle    int `json:"session_idle"`    // commands executed without one of a client before its session is dropped, 0 keeps sessions
+	Retries        int `json:"retries"`         // times a client resends a command that timed out or met a full mempool
+	RequestTimeout int `json:"request_timeout"` // ms a client waits for a reply, no timeout if 0
+	CommitTimeout  int `json:"commit_timeout"`  // ms a replica waits for the commitment before it replies 504, no timeout if 0
+
+	// per node Byzantine strategy, overrides byzNo and strategy for the listed nodes
+	Strategies map[identity.NodeID]string `json:"strategies"`
+
 	hasher string
 	signer string
 
@@ -64,14 +98,18 @@ type Config struct {
 
 // Bconfig holds all benchmark configuration
 type Bconfig struct {
-	T            int    // total number of running time in seconds
-	N            int    // total number of requests
-	K            int    // key sapce
-	Throttle     int    // requests per second throttle, unused if 0
-	Concurrency  int    // number of simulated clients
-	Distribution string // distribution
+	T            int     // total number of running time in seconds
+	N            int     // total number of requests
+	K            int     // key sapce
+	W            float64 // write ratio
+	Throttle     int     // requests per second throttle, unused if 0
+	Concurrency  int     // number of simulated clients
+	Distribution string  // distribution
+	Rate         float64 // rate of open loop Poisson arrivals per second, closed loop if 0
 	// rounds       int    // repeat in many rounds sequentially
 
+	LinearizabilityCheck bool // check linearizability of the history at the end of benchmark
+
 	// conflict distribution
 	Conflicts int // percentage of conflicting keys
 	Min       int // min key
@@ -81,6 +119,13 @@ type Bconfig struct {
 	Sigma float64 // sigma of normal distribution
 	Move  bool    // moving average (mu) of normal distribution
 	Speed int     // moving speed in milliseconds intervals per key
+
+	// zipfian distribution
+	ZipfianS float64 `json:"Zipfian_s"` // zipfian s parameter, s > 1
+	ZipfianV float64 `json:"Zipfian_v"` // zipfian v parameter, v >= 1
+
+	// exponential distribution
+	Lambda float64 // rate parameter of exponential distribution, the mean key is 1/Lambda
 }
 
 // Config is global configuration singleton generated by init() func below
@@ -114,7 +159,19 @@ func MakeDefaultConfig() Config {
 		MultiVersion:   false,
 		hasher:         "sha3_256",
 		signer:         "ECDSA_P256",
-		//Benchmark:      DefaultBConfig(),
+		MaxTxBytes:     1 << 20,
+		MemBytes:       1 << 30,
+		MaxBlockBytes:  32 << 20,
+		MaxBatch:       1024,
+		MaxBatchBytes:  32 << 20,
+		SessionWindow:  1024,
+		SessionIdle:    1 << 20,
+		CommitTimeout:  30000,
+		GossipBatch:    100,
+		GossipDelay:    10,
+		WorkerBatch:    100,
+		WorkerDelay:    10,
+		Benchmark:      Bconfig{W: 1}, // only writes unless configured
 	}
 }
 
@@ -226,5 +283,19 @@ func (c Config) Save() error {
 }
 
 func (c Config) IsByzantine(id identity.NodeID) bool {
+	if strategy, ok := c.Strategies[id]; ok {
+		return strategy != "" && strategy != "honest"
+	}
 	return c.ByzNo >= id.Node()
 }
+
+// StrategyOf returns the Byzantine strategy of the node, empty for honest nodes
+func (c Config) StrategyOf(id identity.NodeID) string {
+	if strategy, ok := c.Strategies[id]; ok {
+		return strategy
+	}
+	if c.IsByzantine(id) {
+		return c.Strategy
+	}
+	return ""
+}
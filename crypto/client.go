@@ -0,0 +1,47 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/gitferry/bamboo/identity"
+)
+
+// NewClientKey generates a random ECDSA P256 key for a client to sign its transactions
+func NewClientKey() (PrivateKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa_p256_PrivateKey{SignAlg: ECDSA_P256, PrivateKey: priv}, nil
+}
+
+// EncodePublicKey returns the uncompressed point of an ECDSA P256 public key
+func EncodePublicKey(pub PublicKey) []byte {
+	p, ok := pub.(*ecdsa_p256_PublicKey)
+	if !ok {
+		return nil
+	}
+	return elliptic.Marshal(elliptic.P256(), p.PublicKey.X, p.PublicKey.Y)
+}
+
+// DecodePublicKey parses the uncompressed point of an ECDSA P256 public key
+func DecodePublicKey(b []byte) (PublicKey, error) {
+	x, y := elliptic.Unmarshal(elliptic.P256(), b)
+	if x == nil {
+		return nil, errors.New("invalid public key")
+	}
+	return &ecdsa_p256_PublicKey{
+		SignAlg:   ECDSA_P256,
+		PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+	}, nil
+}
+
+// KeyID returns the client id bound to an encoded public key, the hex of the first 8 bytes of its hash
+func KeyID(pub []byte) identity.NodeID {
+	hash := NewSHA3_256().ComputeHash(pub)
+	return identity.NodeID(hex.EncodeToString(hash[:8]))
+}
@@ -61,6 +61,10 @@ func (pub *ecdsa_p256_PublicKey) Algorithm() string {
 }
 
 func (pub *ecdsa_p256_PublicKey) Verify(sig Signature, hash Hash) (bool, error) {
+	// a malformed signature from the network is invalid rather than a panic
+	if len(sig) != 2 {
+		return false, nil
+	}
 	ecdsaSig := sig.ToECDSA()
 	isVerified := ecdsa.Verify(&pub.PublicKey, hash, ecdsaSig.r, ecdsaSig.s)
 	return isVerified, nil
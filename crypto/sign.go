@@ -59,16 +59,25 @@ type StaticRand struct {
 	identity.NodeID
 }
 
+// Read fills x with the node id, so that every process derives the same keys
 func (sr *StaticRand) Read(x []byte) (int, error) {
-	return sr.Node(), nil
+	for i := range x {
+		x[i] = byte(sr.Node())
+	}
+	return len(x), nil
 }
 
 // SetKeys 函数用于初始化私钥和公钥。
 func SetKeys() error {
-	keys = make([]PrivateKey, config.GetConfig().N())
-	pubKeys = make([]PublicKey, config.GetConfig().N())
+	return GenerateKeys(config.GetConfig().N())
+}
+
+// GenerateKeys sets the keys of the nodes 1 to n
+func GenerateKeys(n int) error {
+	keys = make([]PrivateKey, n)
+	pubKeys = make([]PublicKey, n)
 	var err error
-	for i := 0; i < config.GetConfig().N(); i++ {
+	for i := 0; i < n; i++ {
 		keys[i], err = GenerateKey(config.GetConfig().GetSignatureScheme(), identity.NewNodeID(i+1))
 		if err != nil {
 			return err
@@ -1,6 +1,10 @@
 package crypto
 
-import "math/big"
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
 
 type Signature [][]byte
 type AggSig []Signature
@@ -20,3 +24,25 @@ func (sig *Signature) ToECDSA() ECDSASignature {
 	ecdsaSig.s = &s
 	return *ecdsaSig
 }
+
+// EncodeSignature returns the text form of an ECDSA signature, r and s in decimal
+func EncodeSignature(sig Signature) string {
+	if len(sig) != 2 {
+		return ""
+	}
+	return string(sig[0]) + "," + string(sig[1])
+}
+
+// DecodeSignature parses the text form of an ECDSA signature
+func DecodeSignature(s string) (Signature, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return nil, errors.New("invalid signature")
+	}
+	for _, p := range parts {
+		if _, ok := new(big.Int).SetString(p, 10); !ok {
+			return nil, errors.New("invalid signature")
+		}
+	}
+	return Signature{[]byte(parts[0]), []byte(parts[1])}, nil
+}
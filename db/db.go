@@ -52,7 +52,8 @@ func (c Command) String() string {
 // Database defines a database interface
 // TODO replace with more general StateMachine interface
 type Database interface {
-	Execute(Command) Value
+	Execute(Command) (Value, error)
+	Lookup(Command) (Value, bool, error)
 	History(Key) []Value
 	Get(Key) Value
 	Put(Key, Value)
@@ -65,15 +66,26 @@ type database struct {
 	version      int
 	multiversion bool
 	history      map[Key][]Value
+	sessions     map[identity.NodeID]*session
+	window       int // replies cached per session
+	idle         int // commands executed without one of a client before its session is dropped
+	executions   int // commands executed
 }
 
 // NewDatabase returns database that impelements Database interface
 func NewDatabase() Database {
+	window := config.Configuration.SessionWindow
+	if window <= 0 {
+		window = 1
+	}
 	return &database{
 		data:         make(map[Key]Value),
 		version:      0,
 		multiversion: config.Configuration.MultiVersion,
 		history:      make(map[Key][]Value),
+		sessions:     make(map[identity.NodeID]*session),
+		window:       window,
+		idle:         config.Configuration.SessionIdle,
 	}
 }
 
@@ -100,18 +112,32 @@ func (d *database) Execute(c interface{}) interface{} {
 }
 */
 
-// Execute executes a command agaist database
-func (d *database) Execute(c Command) Value {
+// Execute executes a command agaist database, a command of a client is executed once and
+// executing it again returns the reply cached in the session of the client
+func (d *database) Execute(c Command) (Value, error) {
 	d.Lock()
 	defer d.Unlock()
 
+	d.executions++
+	d.dropIdle()
+	var s *session
+	if c.ClientID != "" {
+		s = d.session(c.ClientID)
+		if v, executed, err := s.lookup(c.CommandID); executed {
+			return v, err
+		}
+	}
+
 	// get previous value
 	v := d.data[c.Key]
 
 	// writes new value
 	d.put(c.Key, c.Value)
 
-	return v
+	if s != nil {
+		s.add(c.CommandID, v)
+	}
+	return v, nil
 }
 
 // Get gets the current value and version of given key
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/gitferry/bamboo/identity"
+)
+
+// ErrSessionExpired rejects a command older than the replies cached in the session of its
+// client, it may have been executed already so it is not executed again
+var ErrSessionExpired = errors.New("command is older than the client session")
+
+// maxExecuted bounds the executed command ids a session keeps above its watermark, once
+// exceeded the watermark skips the oldest command not executed, which is then expired
+const maxExecuted = 1 << 14
+
+// session caches the replies of the last commands executed for a client by command id,
+// commands may execute out of order when the client has several outstanding
+type session struct {
+	replies  map[int]Value
+	order    []int // ring of the cached command ids in the order of execution
+	next     int
+	low      int          // every command id up to it is executed
+	executed map[int]bool // the executed command ids above low
+	used     int          // commands executed by the database when the client last had one
+}
+
+func newSession(size int) *session {
+	return &session{
+		replies:  make(map[int]Value, size),
+		order:    make([]int, 0, size),
+		executed: make(map[int]bool),
+	}
+}
+
+// lookup returns the cached reply of the command and whether it is executed
+func (s *session) lookup(cid int) (Value, bool, error) {
+	if v, ok := s.replies[cid]; ok {
+		return v, true, nil
+	}
+	if cid <= s.low || s.executed[cid] {
+		return nil, true, ErrSessionExpired
+	}
+	return nil, false, nil
+}
+
+// add caches the reply of an executed command, forgetting the one executed longest ago
+func (s *session) add(cid int, v Value) {
+	if len(s.order) < cap(s.order) {
+		s.order = append(s.order, cid)
+	} else {
+		delete(s.replies, s.order[s.next])
+		s.order[s.next] = cid
+		s.next = (s.next + 1) % len(s.order)
+	}
+	s.replies[cid] = v
+	s.executed[cid] = true
+	if len(s.executed) > maxExecuted {
+		oldest := cid
+		for id := range s.executed {
+			if id < oldest {
+				oldest = id
+			}
+		}
+		s.low = oldest - 1
+	}
+	for s.executed[s.low+1] {
+		delete(s.executed, s.low+1)
+		s.low++
+	}
+}
+
+// Lookup returns the reply of the command if its client has executed it, the commands
+// without a client id have no session and are never executed
+func (d *database) Lookup(c Command) (Value, bool, error) {
+	if c.ClientID == "" {
+		return nil, false, nil
+	}
+	d.RLock()
+	defer d.RUnlock()
+	s, ok := d.sessions[c.ClientID]
+	if !ok {
+		return nil, false, nil
+	}
+	return s.lookup(c.CommandID)
+}
+
+// session returns the session of the client, created on its first command
+func (d *database) session(id identity.NodeID) *session {
+	s, ok := d.sessions[id]
+	if !ok {
+		s = newSession(d.window)
+		d.sessions[id] = s
+	}
+	s.used = d.executions
+	return s
+}
+
+// dropIdle drops the sessions of the clients without a command among the last idle ones executed,
+// idleness is counted in commands rather than time so that every replica drops the same sessions
+func (d *database) dropIdle() {
+	if d.idle <= 0 || d.executions%d.idle != 0 {
+		return
+	}
+	for id, s := range d.sessions {
+		if d.executions-s.used >= d.idle {
+			delete(d.sessions, id)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gitferry/bamboo/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDatabase(window int) *database {
+	return &database{
+		data:     make(map[Key]Value),
+		history:  make(map[Key][]Value),
+		sessions: make(map[identity.NodeID]*session),
+		window:   window,
+	}
+}
+
+func TestExecuteOnce(t *testing.T) {
+	d := newTestDatabase(4)
+	put := func(cid int, v string) Command {
+		return Command{Key: 1, Value: Value(v), ClientID: "c", CommandID: cid}
+	}
+
+	v, err := d.Execute(put(1, "a"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = d.Execute(put(2, "b"))
+	require.NoError(t, err)
+	require.Equal(t, Value("a"), v)
+
+	// a retry gets the first reply and is not applied again
+	v, err = d.Execute(put(1, "a"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	require.Equal(t, Value("b"), d.Get(1))
+
+	v, executed, err := d.Lookup(put(2, "b"))
+	require.NoError(t, err)
+	require.True(t, executed)
+	require.Equal(t, Value("a"), v)
+	_, executed, _ = d.Lookup(put(3, "c"))
+	require.False(t, executed)
+
+	// other clients and anonymous commands have their own commands
+	v, err = d.Execute(Command{Key: 1, Value: Value("x"), ClientID: "other", CommandID: 1})
+	require.NoError(t, err)
+	require.Equal(t, Value("b"), v)
+	_, executed, _ = d.Lookup(Command{Key: 1, Value: Value("y")})
+	require.False(t, executed)
+}
+
+func TestSessionWindow(t *testing.T) {
+	d := newTestDatabase(2)
+	cmd := func(cid int) Command {
+		return Command{Key: Key(cid), Value: Value("v"), ClientID: "c", CommandID: cid}
+	}
+	// commands execute out of order
+	for _, cid := range []int{2, 1, 4} {
+		_, err := d.Execute(cmd(cid))
+		require.NoError(t, err)
+	}
+
+	// the reply of 2 is forgotten, the one of 1 is still cached and 3 is not executed
+	_, executed, err := d.Lookup(cmd(2))
+	require.True(t, executed)
+	require.Equal(t, ErrSessionExpired, err)
+	_, executed, _ = d.Lookup(cmd(1))
+	require.True(t, executed)
+	_, executed, _ = d.Lookup(cmd(3))
+	require.False(t, executed)
+
+	_, err = d.Execute(cmd(3))
+	require.NoError(t, err)
+	// forgetting 1 does not lower the watermark
+	_, executed, err = d.Lookup(cmd(1))
+	require.True(t, executed)
+	require.Equal(t, ErrSessionExpired, err)
+	_, executed, _ = d.Lookup(cmd(5))
+	require.False(t, executed)
+}
+
+func TestSessionGap(t *testing.T) {
+	d := newTestDatabase(2)
+	cmd := func(cid int) Command {
+		return Command{Key: 1, Value: Value(strconv.Itoa(cid)), ClientID: "c", CommandID: cid}
+	}
+	for _, cid := range []int{2, 3, 4} {
+		_, err := d.Execute(cmd(cid))
+		require.NoError(t, err)
+	}
+	// the reply of 2 is forgotten, 1 was never executed and is not expired
+	_, executed, err := d.Lookup(cmd(2))
+	require.True(t, executed)
+	require.Equal(t, ErrSessionExpired, err)
+	_, executed, err = d.Lookup(cmd(1))
+	require.NoError(t, err)
+	require.False(t, executed)
+	v, err := d.Execute(cmd(1))
+	require.NoError(t, err)
+	require.Equal(t, Value("4"), v)
+	require.Equal(t, 4, d.sessions["c"].low)
+	require.Empty(t, d.sessions["c"].executed)
+
+	// a command too far behind the executed ones is expired
+	s := newSession(1)
+	for cid := 2; cid <= maxExecuted+1; cid++ {
+		s.add(cid, nil)
+	}
+	_, executed, _ = s.lookup(1)
+	require.False(t, executed)
+	s.add(maxExecuted+2, nil)
+	_, executed, err = s.lookup(1)
+	require.True(t, executed)
+	require.Equal(t, ErrSessionExpired, err)
+	require.Equal(t, maxExecuted+2, s.low)
+}
+
+func TestSessionIdle(t *testing.T) {
+	d := newTestDatabase(2)
+	d.idle = 3
+	_, err := d.Execute(Command{Key: 1, ClientID: "idle", CommandID: 1})
+	require.NoError(t, err)
+	for cid := 1; cid <= 3; cid++ {
+		_, err := d.Execute(Command{Key: 1, ClientID: "busy", CommandID: cid})
+		require.NoError(t, err)
+	}
+	require.Equal(t, 4, d.executions)
+	// the sessions are checked every idle commands, the idle client is dropped at the first
+	// check after idle commands are executed without one of its own
+	for i := 0; i < 2; i++ {
+		require.Contains(t, d.sessions, identity.NodeID("idle"))
+		_, err = d.Execute(Command{Key: 1})
+		require.NoError(t, err)
+	}
+	require.NotContains(t, d.sessions, identity.NodeID("idle"))
+	require.Contains(t, d.sessions, identity.NodeID("busy"))
+}
@@ -173,7 +173,7 @@ func (lb *Lbft) MakeProposal(view types.View, payload []*message.Transaction) *b
 		BlockID:   prevID,
 		AggSig:    nil,
 		Signature: nil,
-	}, prevID, payload, lb.ID())
+	}, prevID, payload, nil, lb.ID())
 	return block
 }
 
@@ -220,7 +220,7 @@ func (lb *Lbft) processCertificate(qc *blockchain.QC) {
 	err = lb.updateNotarizedChain(qc)
 	if err != nil {
 		// the corresponding block does not exist
-		log.Debugf("[%v] cannot notarize the block, %x: %w", lb.ID(), qc.BlockID, err)
+		log.Debugf("[%v] cannot notarize the block, %x: %v", lb.ID(), qc.BlockID, err)
 		return
 	}
 	lb.pm.AdvanceView(qc.View)
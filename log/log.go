@@ -128,55 +128,43 @@ func Setup() {
 }
 
 func Debug(v ...interface{}) {
-	if log.severity == DEBUG {
-		log.debug.Output(2, fmt.Sprint(v...))
-	}
+	log.output(1, DEBUG, "", nil, func() string { return fmt.Sprint(v...) })
 }
 
 func Debugf(format string, v ...interface{}) {
-	if log.severity == DEBUG {
-		log.debug.Output(2, fmt.Sprintf(format, v...))
-	}
+	log.output(1, DEBUG, "", nil, func() string { return fmt.Sprintf(format, v...) })
 }
 
 func Info(v ...interface{}) {
-	if log.severity <= INFO {
-		log.info.Output(2, fmt.Sprint(v...))
-	}
+	log.output(1, INFO, "", nil, func() string { return fmt.Sprint(v...) })
 }
 
 func Infof(format string, v ...interface{}) {
-	if log.severity <= INFO {
-		log.info.Output(2, fmt.Sprintf(format, v...))
-	}
+	log.output(1, INFO, "", nil, func() string { return fmt.Sprintf(format, v...) })
 }
 
 func Warning(v ...interface{}) {
-	if log.severity <= WARNING {
-		log.warning.Output(2, fmt.Sprint(v...))
-	}
+	log.output(1, WARNING, "", nil, func() string { return fmt.Sprint(v...) })
 }
 
 func Warningf(format string, v ...interface{}) {
-	if log.severity <= WARNING {
-		log.warning.Output(2, fmt.Sprintf(format, v...))
-	}
+	log.output(1, WARNING, "", nil, func() string { return fmt.Sprintf(format, v...) })
 }
 
 func Error(v ...interface{}) {
-	log.err.Output(2, fmt.Sprint(v...))
+	log.output(1, ERROR, "", nil, func() string { return fmt.Sprint(v...) })
 }
 
 func Errorf(format string, v ...interface{}) {
-	log.err.Output(2, fmt.Sprintf(format, v...))
+	log.output(1, ERROR, "", nil, func() string { return fmt.Sprintf(format, v...) })
 }
 
 func Fatal(v ...interface{}) {
-	log.err.Output(2, fmt.Sprint(v...))
-	stdlog.Fatal(v...)
+	log.output(1, ERROR, "", nil, func() string { return fmt.Sprint(v...) })
+	os.Exit(1)
 }
 
 func Fatalf(format string, v ...interface{}) {
-	log.err.Output(2, fmt.Sprintf(format, v...))
-	stdlog.Fatalf(format, v...)
+	log.output(1, ERROR, "", nil, func() string { return fmt.Sprintf(format, v...) })
+	os.Exit(1)
 }
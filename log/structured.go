@@ -0,0 +1,252 @@
+package log
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	stdlog "log"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+var format = flag.String("log_format", "text", "log format, text or json with one object per line")
+
+// levels overrides the log level by component, the package of the caller unless given
+var levels = make(componentLevels)
+
+func init() {
+	flag.Var(levels, "log_levels", "comma separated levels by component overriding log_level, e.g. replica=debug,mempool=warning")
+}
+
+type componentLevels map[string]severity
+
+func (c componentLevels) String() string {
+	var pairs []string
+	for component, s := range c {
+		pairs = append(pairs, component+"="+s.String())
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (c componentLevels) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid component level %q, expecting component=level", pair)
+		}
+		var s severity
+		s.Set(kv[1])
+		c[kv[0]] = s
+	}
+	return nil
+}
+
+// components caches the package of the callers by program counter
+var components sync.Map
+
+// caller returns the component, file and line of the caller skip frames above
+func caller(skip int) (string, string, int) {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return "", "???", 0
+	}
+	file = file[strings.LastIndex(file, "/")+1:]
+	if c, ok := components.Load(pc); ok {
+		return c.(string), file, line
+	}
+	// github.com/gitferry/bamboo/replica.(*Replica).HandleBlock
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+	components.Store(pc, name)
+	return name, file, line
+}
+
+func (l *logger) enabled(s severity, component string) bool {
+	if threshold, ok := levels[component]; ok {
+		return s >= threshold
+	}
+	return s >= l.severity
+}
+
+// output writes an entry of the caller depth frames above, the message is only formatted if the entry is written
+func (l *logger) output(depth int, s severity, component string, fields []interface{}, msg func() string) {
+	if len(levels) == 0 && *format != "json" {
+		// plain text at a global level needs no caller lookup
+		if s < l.severity && s != ERROR {
+			return
+		}
+		l.writer(s).Output(depth+2, msg()+text(fields))
+		return
+	}
+	c, file, line := caller(depth + 1)
+	if component == "" {
+		component = c
+	}
+	// errors are always logged
+	if s != ERROR && !l.enabled(s, component) {
+		return
+	}
+	if *format != "json" {
+		l.writer(s).Output(depth+2, msg()+text(fields))
+		return
+	}
+	entry := new(bytes.Buffer)
+	entry.WriteString(`{"time":`)
+	writeJSON(entry, time.Now().Format(time.RFC3339Nano))
+	entry.WriteString(`,"level":`)
+	writeJSON(entry, s.String())
+	entry.WriteString(`,"component":`)
+	writeJSON(entry, component)
+	entry.WriteString(`,"caller":`)
+	writeJSON(entry, fmt.Sprintf("%s:%d", file, line))
+	entry.WriteString(`,"msg":`)
+	writeJSON(entry, msg())
+	for i := 0; i+1 < len(fields); i += 2 {
+		entry.WriteByte(',')
+		writeJSON(entry, fmt.Sprint(fields[i]))
+		entry.WriteByte(':')
+		writeJSON(entry, value(fields[i+1]))
+	}
+	entry.WriteString("}\n")
+	w := l.writer(s).Writer()
+	l.Lock()
+	w.Write(entry.Bytes())
+	l.Unlock()
+}
+
+func (l *logger) writer(s severity) *stdlog.Logger {
+	switch s {
+	case DEBUG:
+		return l.debug
+	case INFO:
+		return l.info
+	case WARNING:
+		return l.warning
+	}
+	return l.err
+}
+
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+// value returns the field value as logged, errors and stringers as strings and bytes in hex
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case nil, string, bool, int, int64, uint64, float64:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	r := reflect.ValueOf(v)
+	switch r.Kind() {
+	case reflect.Array, reflect.Slice:
+		if r.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, r.Len())
+			reflect.Copy(reflect.ValueOf(b), r)
+			return hex.EncodeToString(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return r.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return r.Uint()
+	case reflect.Float32, reflect.Float64:
+		return r.Float()
+	case reflect.String:
+		return r.String()
+	}
+	return v
+}
+
+// text appends the fields as key=value pairs
+func text(fields []interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", fields[i], value(fields[i+1]))
+	}
+	return b.String()
+}
+
+// Logger adds fields to every entry, the key value pairs like node, view and block_id
+type Logger struct {
+	component string
+	fields    []interface{}
+}
+
+// With returns a logger adding the key value pairs to every entry
+func With(keysAndValues ...interface{}) *Logger {
+	return &Logger{fields: keysAndValues}
+}
+
+// Component returns a logger of the named component, whose level may be set by -log_levels
+func Component(name string) *Logger {
+	return &Logger{component: name}
+}
+
+// With returns a logger adding the key value pairs to those of l
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(append(fields, l.fields...), keysAndValues...)
+	return &Logger{component: l.component, fields: fields}
+}
+
+func (l *Logger) log(s severity, msg func() string, keysAndValues []interface{}) {
+	fields := l.fields
+	if len(keysAndValues) > 0 {
+		fields = append(append(make([]interface{}, 0, len(fields)+len(keysAndValues)), fields...), keysAndValues...)
+	}
+	log.output(2, s, l.component, fields, msg)
+}
+
+// Debugw logs the message with the key value pairs at DEBUG level
+func (l *Logger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.log(DEBUG, func() string { return msg }, keysAndValues)
+}
+
+// Infow logs the message with the key value pairs at INFO level
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.log(INFO, func() string { return msg }, keysAndValues)
+}
+
+// Warningw logs the message with the key value pairs at WARNING level
+func (l *Logger) Warningw(msg string, keysAndValues ...interface{}) {
+	l.log(WARNING, func() string { return msg }, keysAndValues)
+}
+
+// Errorw logs the message with the key value pairs at ERROR level
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.log(ERROR, func() string { return msg }, keysAndValues)
+}
+
+func (l *Logger) Debugf(format string, v ...interface{}) {
+	l.log(DEBUG, func() string { return fmt.Sprintf(format, v...) }, nil)
+}
+
+func (l *Logger) Infof(format string, v ...interface{}) {
+	l.log(INFO, func() string { return fmt.Sprintf(format, v...) }, nil)
+}
+
+func (l *Logger) Warningf(format string, v ...interface{}) {
+	l.log(WARNING, func() string { return fmt.Sprintf(format, v...) }, nil)
+}
+
+func (l *Logger) Errorf(format string, v ...interface{}) {
+	l.log(ERROR, func() string { return fmt.Sprintf(format, v...) }, nil)
+}
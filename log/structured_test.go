@@ -0,0 +1,56 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	stdlog "log"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func capture(t *testing.T, f func()) string {
+	var buf bytes.Buffer
+	debug, info, warning, err, severity := log.debug, log.info, log.warning, log.err, log.severity
+	log.debug = stdlog.New(&buf, "[DEBUG] ", 0)
+	log.info = stdlog.New(&buf, "[INFO] ", 0)
+	log.warning = stdlog.New(&buf, "[WARNING] ", 0)
+	log.err = stdlog.New(&buf, "[ERROR] ", 0)
+	defer func() {
+		log.debug, log.info, log.warning, log.err, log.severity = debug, info, warning, err, severity
+		*format = "text"
+		levels = make(componentLevels)
+	}()
+	f()
+	return buf.String()
+}
+
+func TestJSON(t *testing.T) {
+	out := capture(t, func() {
+		*format = "json"
+		log.severity = INFO
+		With("node", "1").Infow("the block is committed", "view", 3, "block_id", [2]byte{0xab, 0xcd})
+		Debugf("filtered")
+	})
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &entry))
+	require.Equal(t, "INFO", entry["level"])
+	require.Equal(t, "log", entry["component"])
+	require.True(t, strings.HasPrefix(entry["caller"].(string), "structured_test.go:"))
+	require.Equal(t, "the block is committed", entry["msg"])
+	require.Equal(t, "1", entry["node"])
+	require.Equal(t, 3.0, entry["view"])
+	require.Equal(t, "abcd", entry["block_id"])
+}
+
+func TestComponentLevels(t *testing.T) {
+	out := capture(t, func() {
+		log.severity = WARNING
+		require.NoError(t, levels.Set("log=debug,mempool=error"))
+		Debugf("package level %d", 1)
+		Component("mempool").Warningf("filtered")
+		Component("mempool").Errorw("kept", "size", 2)
+	})
+	require.Equal(t, "[DEBUG] package level 1\n[ERROR] kept size=2\n", out)
+}
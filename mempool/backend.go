@@ -1,66 +1,159 @@
 package mempool
 
 import (
-	"container/list"
 	"github.com/gitferry/bamboo/message"
 	"sync"
 )
 
 type Backend struct {
-	txns          *list.List
-	limit         int
+	txns          Policy
+	limit         int // no limit if 0
+	maxBytes      int // limit of the payload bytes pending, no limit if 0
+	maxTxBytes    int // limit of the payload bytes of a transaction, no limit if 0
+	bytes         int
 	totalReceived int64
-	*BloomFilter
-	mu *sync.Mutex
+	dedup         *dedup
+	mu            *sync.Mutex
 }
 
-func NewBackend(limit int) *Backend {
+func NewBackend(limit int, policy Policy) *Backend {
 	var mu sync.Mutex
 	return &Backend{
-		txns:        list.New(),
-		BloomFilter: NewBloomFilter(),
-		mu:          &mu,
-		limit:       limit,
+		txns:  policy,
+		dedup: newDedup(dedupGeneration),
+		mu:    &mu,
+		limit: limit,
 	}
 }
 
-func (b *Backend) insertBack(txn *message.Transaction) {
+// limitBytes limits the payload bytes of a transaction and of all pending ones, no limit if 0
+func (b *Backend) limitBytes(maxTxBytes, maxBytes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.maxTxBytes = maxTxBytes
+	b.maxBytes = maxBytes
+}
+
+// insertBack adds a new transaction, duplicates and committed transactions are rejected
+// and so are transactions larger than the limit with ErrTooLarge. When the pool is full
+// the policy either evicts transactions until it has room, which are returned, or the
+// new transaction is rejected with ErrFull
+func (b *Backend) insertBack(txn *message.Transaction) ([]*message.Transaction, error) {
 	if txn == nil {
-		return
+		return nil, nil
 	}
+	size := txn.Size()
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if b.size() > b.limit {
-		return
+	if b.maxTxBytes > 0 && size > b.maxTxBytes {
+		return nil, ErrTooLarge
+	}
+	if err := b.dedup.check(txn.ID); err != nil {
+		return nil, err
+	}
+	var evicted []*message.Transaction
+	for b.full(size) {
+		e := b.txns.Evict(txn)
+		if e == nil {
+			// the transactions evicted in vain are put back, newest last
+			for i := len(evicted) - 1; i >= 0; i-- {
+				b.push(evicted[i])
+			}
+			return nil, ErrFull
+		}
+		b.bytes -= e.Size()
+		evicted = append(evicted, e)
 	}
+	for _, e := range evicted {
+		// the evicted transaction may be submitted again
+		b.dedup.forget(e.ID)
+	}
+	b.dedup.add(txn.ID, false)
 	b.totalReceived++
-	b.txns.PushBack(txn)
+	b.push(txn)
+	return evicted, nil
+}
+
+// full reports whether a transaction of the size has no room, the lock is held
+func (b *Backend) full(size int) bool {
+	if b.size() == 0 {
+		return false
+	}
+	return b.limit > 0 && b.size() >= b.limit || b.maxBytes > 0 && b.bytes+size > b.maxBytes
 }
 
-func (b *Backend) insertFront(txn *message.Transaction) {
+func (b *Backend) push(txn *message.Transaction) {
+	b.bytes += txn.Size()
+	b.txns.Push(txn)
+}
+
+func (b *Backend) pushFront(txn *message.Transaction) {
+	b.bytes += txn.Size()
+	b.txns.PushFront(txn)
+}
+
+func (b *Backend) pop() *message.Transaction {
+	txn := b.txns.Pop()
+	if txn != nil {
+		b.bytes -= txn.Size()
+	}
+	return txn
+}
+
+// insertFront puts back a transaction of a forked block unless it has been committed since,
+// it returns false if the transaction is dropped
+func (b *Backend) insertFront(txn *message.Transaction) bool {
 	if txn == nil {
-		return
+		return false
 	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.txns.PushFront(txn)
+	if _, committed := b.dedup.lookup(txn.ID); committed {
+		return false
+	}
+	b.pushFront(txn)
+	return true
+}
+
+// committed remembers the transactions of a committed block and removes the pending
+// transactions of the same ids, which are returned
+func (b *Backend) committed(txns []*message.Transaction) []*message.Transaction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var removed []*message.Transaction
+	for _, txn := range txns {
+		b.dedup.add(txn.ID, true)
+		if pending := b.txns.Remove(txn.ID); pending != nil {
+			b.bytes -= pending.Size()
+			removed = append(removed, pending)
+		}
+	}
+	return removed
 }
 
 func (b *Backend) size() int {
 	return b.txns.Len()
 }
 
-func (b *Backend) front() *message.Transaction {
-	if b.size() == 0 {
-		return nil
-	}
-	ele := b.txns.Front()
-	val, ok := ele.Value.(*message.Transaction)
-	if !ok {
-		return nil
-	}
-	b.txns.Remove(ele)
-	return val
+// Size returns the number of transactions in the pool
+func (b *Backend) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.size()
+}
+
+// TotalReceived returns the number of transactions accepted into the pool
+func (b *Backend) TotalReceived() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.totalReceived
+}
+
+// Bytes returns the payload bytes of the transactions in the pool
+func (b *Backend) Bytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytes
 }
 
 func (b *Backend) some(n int) []*message.Transaction {
@@ -73,12 +166,33 @@ func (b *Backend) some(n int) []*message.Transaction {
 	}
 	batch := make([]*message.Transaction, 0, batchSize)
 	for i := 0; i < batchSize; i++ {
-		tx := b.front()
+		tx := b.pop()
 		batch = append(batch, tx)
 	}
 	return batch
 }
 
-func (b *Backend) addToBloom(id string) {
-	b.Add(id)
+// take removes up to n transactions holding up to maxBytes of payload, at least one,
+// no byte limit if maxBytes is 0
+func (b *Backend) take(n, maxBytes int) []*message.Transaction {
+	if maxBytes <= 0 {
+		return b.some(n)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var batch []*message.Transaction
+	bytes := 0
+	for len(batch) < n {
+		tx := b.pop()
+		if tx == nil {
+			break
+		}
+		bytes += tx.Size()
+		if len(batch) > 0 && bytes > maxBytes {
+			b.pushFront(tx)
+			break
+		}
+		batch = append(batch, tx)
+	}
+	return batch
 }
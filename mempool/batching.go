@@ -0,0 +1,137 @@
+package mempool
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+)
+
+// batching policies
+const (
+	FIXED    = "fixed"
+	ADAPTIVE = "adaptive"
+)
+
+// roundWeight is the weight of the latest round time in its moving average
+const roundWeight = 0.2
+
+// Batching decides how many transactions the next block takes from the memory pool
+type Batching interface {
+	// Next returns the number of transactions to propose out of the pending ones, 0 to wait
+	Next(pending int) int
+	// Bytes returns the payload bytes a block is filled up to, no limit if 0
+	Bytes() int
+	// Round tells the duration of the last view
+	Round(d time.Duration)
+	// Limit returns the current number of transactions a block is filled up to
+	Limit() int
+}
+
+// NewBatching creates the batching policy of the name with the block size of the configuration
+func NewBatching(name string) Batching {
+	switch name {
+	case ADAPTIVE:
+		c := config.GetConfig()
+		return newAdaptive(c.BSize, c.TargetBytes,
+			time.Duration(c.TargetLatency)*time.Millisecond,
+			time.Duration(c.FillTimeout)*time.Millisecond)
+	default:
+		return fixed(config.GetConfig().BSize)
+	}
+}
+
+// fixed takes up to bsize transactions whenever there are any
+type fixed int
+
+func (f fixed) Next(pending int) int {
+	if pending < int(f) {
+		return pending
+	}
+	return int(f)
+}
+
+func (f fixed) Bytes() int            { return 0 }
+func (f fixed) Round(d time.Duration) {}
+func (f fixed) Limit() int            { return int(f) }
+
+// adaptive fills blocks up to a size limit that grows while the views are faster than the
+// target latency and halves when they are slower. A block below the limit is proposed only
+// once the last non-empty block is older than the fill timeout, so that blocks fill up at
+// low load, and blocks stop at the target bytes whatever the limit
+type adaptive struct {
+	max           int // upper bound of the limit
+	targetBytes   int
+	targetLatency time.Duration // no adaptation if 0
+	fillTimeout   time.Duration
+
+	mu    sync.Mutex
+	limit int
+	round time.Duration // moving average of the view duration
+	last  time.Time     // when the last non-empty block was taken
+}
+
+func newAdaptive(max, targetBytes int, targetLatency, fillTimeout time.Duration) *adaptive {
+	if max <= 0 {
+		max = 1
+	}
+	return &adaptive{
+		max:           max,
+		targetBytes:   targetBytes,
+		targetLatency: targetLatency,
+		fillTimeout:   fillTimeout,
+		limit:         max,
+	}
+}
+
+func (a *adaptive) Next(pending int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if pending == 0 {
+		return 0
+	}
+	n := a.limit
+	if pending < n {
+		if time.Since(a.last) < a.fillTimeout {
+			return 0
+		}
+		n = pending
+	}
+	a.last = time.Now()
+	return n
+}
+
+func (a *adaptive) Bytes() int {
+	return a.targetBytes
+}
+
+func (a *adaptive) Round(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.round == 0 {
+		a.round = d
+	} else {
+		a.round = time.Duration(roundWeight*float64(d) + (1-roundWeight)*float64(a.round))
+	}
+	if a.targetLatency == 0 {
+		return
+	}
+	if a.round > a.targetLatency {
+		a.limit /= 2
+		if a.limit < 1 {
+			a.limit = 1
+		}
+		return
+	}
+	// additive increase reaches the bound in about 16 views
+	a.limit += a.max/16 + 1
+	if a.limit > a.max {
+		a.limit = a.max
+	}
+}
+
+func (a *adaptive) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
@@ -0,0 +1,53 @@
+package mempool
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedBatching(t *testing.T) {
+	f := fixed(10)
+	require.Equal(t, 3, f.Next(3))
+	require.Equal(t, 10, f.Next(30))
+}
+
+func TestAdaptiveFillOrTimeout(t *testing.T) {
+	a := newAdaptive(10, 0, 0, time.Hour)
+	require.Equal(t, 0, a.Next(0))
+	// a full block is taken at once
+	require.Equal(t, 10, a.Next(25))
+	// a partial block waits for the fill timeout
+	require.Equal(t, 0, a.Next(5))
+	a.last = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, 5, a.Next(5))
+}
+
+func TestAdaptiveLatency(t *testing.T) {
+	a := newAdaptive(64, 0, 10*time.Millisecond, 0)
+	a.Round(20 * time.Millisecond)
+	require.Equal(t, 32, a.Limit())
+	a.Round(20 * time.Millisecond)
+	require.Equal(t, 16, a.Limit())
+	for i := 0; i < 20; i++ {
+		a.Round(time.Millisecond)
+	}
+	require.Equal(t, 64, a.Limit())
+}
+
+func TestTakeBytes(t *testing.T) {
+	b := NewBackend(0, NewPolicy(FIFO))
+	for i := 0; i < 5; i++ {
+		b.insertBack(&message.Transaction{ID: strconv.Itoa(i), Command: db.Command{Value: make([]byte, 1)}})
+	}
+	// every transaction counts 10 bytes
+	require.Len(t, b.take(5, 25), 2)
+	require.Equal(t, 3, b.Size())
+	// one transaction is taken whatever its size
+	require.Len(t, b.take(5, 1), 1)
+	require.Len(t, b.take(5, 0), 2)
+}
@@ -0,0 +1,90 @@
+package mempool
+
+import "errors"
+
+var (
+	// ErrDuplicate rejects a transaction already in the memory pool or proposed
+	ErrDuplicate = errors.New("duplicate transaction")
+	// ErrCommitted rejects a transaction already included in a committed block
+	ErrCommitted = errors.New("transaction already committed")
+	// ErrFull rejects a transaction when the memory pool is full
+	ErrFull = errors.New("memory pool is full")
+	// ErrTooLarge rejects a transaction larger than the limit of a transaction
+	ErrTooLarge = errors.New("transaction too large")
+	// ErrEvicted replies to a transaction evicted from the full memory pool
+	ErrEvicted = errors.New("transaction evicted from the full memory pool")
+)
+
+// dedupGeneration is the number of transaction ids held by a generation of the filter
+const dedupGeneration = 1 << 20
+
+// generation is a Bloom filter backed by the exact set of the ids it holds,
+// the filter spares the lookup of ids never seen
+type generation struct {
+	bloom *BloomFilter
+	ids   map[string]bool // whether the transaction is committed
+}
+
+func newGeneration() *generation {
+	return &generation{
+		bloom: NewBloomFilter(),
+		ids:   make(map[string]bool),
+	}
+}
+
+// dedup remembers the ids of the transactions seen in the last one to two generations,
+// the oldest generation is dropped once the current one is full so the filter never saturates
+type dedup struct {
+	size     int // ids per generation
+	current  *generation
+	previous *generation
+}
+
+func newDedup(size int) *dedup {
+	return &dedup{
+		size:     size,
+		current:  newGeneration(),
+		previous: newGeneration(),
+	}
+}
+
+// lookup returns whether the id has been seen and whether it is committed
+func (d *dedup) lookup(id string) (seen bool, committed bool) {
+	for _, g := range []*generation{d.current, d.previous} {
+		if !g.bloom.Contains(id) {
+			continue
+		}
+		if committed, ok := g.ids[id]; ok {
+			return true, committed
+		}
+	}
+	return false, false
+}
+
+// check returns the error rejecting the transaction id, nil if it is new
+func (d *dedup) check(id string) error {
+	seen, committed := d.lookup(id)
+	switch {
+	case committed:
+		return ErrCommitted
+	case seen:
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (d *dedup) add(id string, committed bool) {
+	if len(d.current.ids) >= d.size {
+		d.previous.bloom.Set.ClearAll()
+		d.previous.ids = make(map[string]bool)
+		d.current, d.previous = d.previous, d.current
+	}
+	d.current.bloom.Add(id)
+	d.current.ids[id] = committed
+}
+
+// forget drops the id, it is no longer rejected
+func (d *dedup) forget(id string) {
+	delete(d.current.ids, id)
+	delete(d.previous.ids, id)
+}
@@ -0,0 +1,71 @@
+package mempool
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedup(t *testing.T) {
+	d := newDedup(10)
+	require.NoError(t, d.check("a"))
+	d.add("a", false)
+	require.Equal(t, ErrDuplicate, d.check("a"))
+	d.add("a", true)
+	require.Equal(t, ErrCommitted, d.check("a"))
+	require.NoError(t, d.check("b"))
+}
+
+func TestDedupRotation(t *testing.T) {
+	d := newDedup(10)
+	d.add("old", true)
+	for i := 0; i < 10; i++ {
+		d.add(strconv.Itoa(i), false)
+	}
+	// the first generation is still remembered
+	require.Equal(t, ErrCommitted, d.check("old"))
+	for i := 10; i < 20; i++ {
+		d.add(strconv.Itoa(i), false)
+	}
+	require.NoError(t, d.check("old"))
+	require.Equal(t, ErrDuplicate, d.check("19"))
+}
+
+func TestBackendRejectsDuplicates(t *testing.T) {
+	b := NewBackend(100, NewPolicy(FIFO))
+	_, err := b.insertBack(&message.Transaction{ID: "1"})
+	require.NoError(t, err)
+	_, err = b.insertBack(&message.Transaction{ID: "1"})
+	require.Equal(t, ErrDuplicate, err)
+	require.Len(t, b.some(10), 1)
+	// proposed transactions are still known
+	_, err = b.insertBack(&message.Transaction{ID: "1"})
+	require.Equal(t, ErrDuplicate, err)
+
+	b.committed([]*message.Transaction{{ID: "2"}})
+	_, err = b.insertBack(&message.Transaction{ID: "2"})
+	require.Equal(t, ErrCommitted, err)
+	b.insertFront(&message.Transaction{ID: "2"})
+	require.Equal(t, 0, b.Size())
+}
+
+func TestTotalReceived(t *testing.T) {
+	b := NewBackend(0, NewPolicy(FIFO))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// every transaction is submitted twice, duplicates are not counted
+				b.insertBack(&message.Transaction{ID: strconv.Itoa(i*50 + j%25)})
+				b.TotalReceived()
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int64(100), b.TotalReceived())
+}
@@ -0,0 +1,12 @@
+package mempool
+
+import (
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+)
+
+// Batch is a batch of new transactions relayed from the memory pool of one replica to the others
+type Batch struct {
+	Sender identity.NodeID
+	Txns   []message.Transaction
+}
@@ -13,18 +13,18 @@ type MemPool struct {
 // NewTransactions creates a new memory pool for transactions.
 func NewMemPool() *MemPool {
 	mp := &MemPool{
-		Backend: NewBackend(config.GetConfig().MemSize),
+		Backend: NewBackend(config.GetConfig().MemSize, NewPolicy(config.GetConfig().MemPolicy)),
 	}
+	mp.limitBytes(config.GetConfig().MaxTxBytes, config.GetConfig().MemBytes)
 
 	return mp
 }
 
-func (mp *MemPool) addNew(tx *message.Transaction) {
+func (mp *MemPool) addNew(tx *message.Transaction) ([]*message.Transaction, error) {
 	tx.Timestamp = time.Now()
-	mp.Backend.insertBack(tx)
-	mp.Backend.addToBloom(tx.ID)
+	return mp.Backend.insertBack(tx)
 }
 
-func (mp *MemPool) addOld(tx *message.Transaction) {
-	mp.Backend.insertFront(tx)
+func (mp *MemPool) addOld(tx *message.Transaction) bool {
+	return mp.Backend.insertFront(tx)
 }
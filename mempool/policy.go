@@ -0,0 +1,320 @@
+package mempool
+
+import (
+	"container/heap"
+	"container/list"
+	"strconv"
+
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
+)
+
+// ordering policies of the memory pool
+const (
+	FIFO     = "fifo"     // first come first proposed, new transactions are rejected when full
+	PRIORITY = "priority" // highest fee first, the lowest fee is evicted when full
+	FAIR     = "fair"     // round robin over clients, the client with most transactions is evicted when full
+)
+
+// FeeProperty is the transaction property holding its fee, signed by the client along with the command
+const FeeProperty = message.FeeProperty
+
+// Policy orders the pending transactions and chooses the victims when the pool is full
+type Policy interface {
+	// Push adds a new transaction
+	Push(txn *message.Transaction)
+	// PushFront adds back a transaction taken before, it is proposed first among its peers
+	PushFront(txn *message.Transaction)
+	// Pop removes and returns the next transaction to propose, nil if empty
+	Pop() *message.Transaction
+	// Evict removes and returns a transaction to make room for txn, nil if txn is to be rejected
+	Evict(txn *message.Transaction) *message.Transaction
+	// Remove removes and returns the transaction of the id, nil if it is not pending
+	Remove(id string) *message.Transaction
+	Len() int
+}
+
+// NewPolicy returns the named ordering policy, FIFO if empty
+func NewPolicy(name string) Policy {
+	switch name {
+	case "", FIFO:
+		return &fifo{txns: list.New(), index: make(map[string]*list.Element)}
+	case PRIORITY:
+		return newPriority()
+	case FAIR:
+		return newFair()
+	}
+	log.Fatalf("unknown mempool policy %s", name)
+	return nil
+}
+
+/************
+ *   FIFO   *
+ ************/
+
+type fifo struct {
+	txns  *list.List
+	index map[string]*list.Element
+}
+
+func (f *fifo) Push(txn *message.Transaction) {
+	f.index[txn.ID] = f.txns.PushBack(txn)
+}
+
+func (f *fifo) PushFront(txn *message.Transaction) {
+	f.index[txn.ID] = f.txns.PushFront(txn)
+}
+
+func (f *fifo) Pop() *message.Transaction {
+	e := f.txns.Front()
+	if e == nil {
+		return nil
+	}
+	return f.remove(e)
+}
+
+func (f *fifo) remove(e *list.Element) *message.Transaction {
+	txn := f.txns.Remove(e).(*message.Transaction)
+	delete(f.index, txn.ID)
+	return txn
+}
+
+func (f *fifo) Remove(id string) *message.Transaction {
+	e, ok := f.index[id]
+	if !ok {
+		return nil
+	}
+	return f.remove(e)
+}
+
+func (f *fifo) Evict(*message.Transaction) *message.Transaction {
+	return nil
+}
+
+func (f *fifo) Len() int {
+	return f.txns.Len()
+}
+
+/************
+ * PRIORITY *
+ ************/
+
+// fee returns the fee of the transaction, 0 if it has none
+func fee(txn *message.Transaction) float64 {
+	f, err := strconv.ParseFloat(txn.Properties[FeeProperty], 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+type item struct {
+	txn   *message.Transaction
+	fee   float64
+	seq   int64
+	index [2]int // position in the max and the min heap
+}
+
+// before orders by fee, then by arrival
+func (a *item) before(b *item) bool {
+	if a.fee != b.fee {
+		return a.fee > b.fee
+	}
+	return a.seq < b.seq
+}
+
+// itemHeap is one side of the double ended priority queue
+type itemHeap struct {
+	items []*item
+	side  int // 0 keeps the next to propose on top, 1 the next to evict
+}
+
+func (h *itemHeap) Len() int {
+	return len(h.items)
+}
+
+func (h *itemHeap) Less(i, j int) bool {
+	if h.side == 0 {
+		return h.items[i].before(h.items[j])
+	}
+	return h.items[j].before(h.items[i])
+}
+
+func (h *itemHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index[h.side] = i
+	h.items[j].index[h.side] = j
+}
+
+func (h *itemHeap) Push(x interface{}) {
+	it := x.(*item)
+	it.index[h.side] = len(h.items)
+	h.items = append(h.items, it)
+}
+
+func (h *itemHeap) Pop() interface{} {
+	n := len(h.items)
+	it := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	return it
+}
+
+type priority struct {
+	first *itemHeap // highest fee on top
+	last  *itemHeap // lowest fee on top
+	index map[string]*item
+	seq   int64 // arrival order, transactions pushed to the front count down
+	front int64
+}
+
+func newPriority() *priority {
+	return &priority{
+		first: &itemHeap{side: 0},
+		last:  &itemHeap{side: 1},
+		index: make(map[string]*item),
+	}
+}
+
+func (p *priority) push(txn *message.Transaction, seq int64) {
+	it := &item{txn: txn, fee: fee(txn), seq: seq}
+	heap.Push(p.first, it)
+	heap.Push(p.last, it)
+	p.index[txn.ID] = it
+}
+
+func (p *priority) remove(it *item) *message.Transaction {
+	heap.Remove(p.first, it.index[0])
+	heap.Remove(p.last, it.index[1])
+	delete(p.index, it.txn.ID)
+	return it.txn
+}
+
+func (p *priority) Push(txn *message.Transaction) {
+	p.seq++
+	p.push(txn, p.seq)
+}
+
+func (p *priority) PushFront(txn *message.Transaction) {
+	p.front--
+	p.push(txn, p.front)
+}
+
+func (p *priority) Pop() *message.Transaction {
+	if p.first.Len() == 0 {
+		return nil
+	}
+	return p.remove(p.first.items[0])
+}
+
+func (p *priority) Evict(txn *message.Transaction) *message.Transaction {
+	if p.last.Len() == 0 || fee(txn) <= p.last.items[0].fee {
+		return nil
+	}
+	return p.remove(p.last.items[0])
+}
+
+func (p *priority) Remove(id string) *message.Transaction {
+	it, ok := p.index[id]
+	if !ok {
+		return nil
+	}
+	return p.remove(it)
+}
+
+func (p *priority) Len() int {
+	return p.first.Len()
+}
+
+/************
+ *   FAIR   *
+ ************/
+
+type fair struct {
+	queues map[identity.NodeID]*list.List // pending transactions by client
+	turns  *list.List                     // clients with pending transactions, the next to propose in front
+	turn   map[identity.NodeID]*list.Element
+	index  map[string]*list.Element
+}
+
+func newFair() *fair {
+	return &fair{
+		queues: make(map[identity.NodeID]*list.List),
+		turns:  list.New(),
+		turn:   make(map[identity.NodeID]*list.Element),
+		index:  make(map[string]*list.Element),
+	}
+}
+
+func (f *fair) queue(client identity.NodeID) *list.List {
+	q, ok := f.queues[client]
+	if !ok {
+		q = list.New()
+		f.queues[client] = q
+		f.turn[client] = f.turns.PushBack(client)
+	}
+	return q
+}
+
+func (f *fair) Push(txn *message.Transaction) {
+	f.index[txn.ID] = f.queue(txn.Command.ClientID).PushBack(txn)
+}
+
+func (f *fair) PushFront(txn *message.Transaction) {
+	f.index[txn.ID] = f.queue(txn.Command.ClientID).PushFront(txn)
+}
+
+// remove takes the transaction out of the client queue, the client loses its turn once done
+func (f *fair) remove(client identity.NodeID, e *list.Element) *message.Transaction {
+	q := f.queues[client]
+	txn := q.Remove(e).(*message.Transaction)
+	delete(f.index, txn.ID)
+	if q.Len() == 0 {
+		delete(f.queues, client)
+		f.turns.Remove(f.turn[client])
+		delete(f.turn, client)
+	}
+	return txn
+}
+
+func (f *fair) Pop() *message.Transaction {
+	e := f.turns.Front()
+	if e == nil {
+		return nil
+	}
+	client := e.Value.(identity.NodeID)
+	f.turns.MoveToBack(e)
+	return f.remove(client, f.queues[client].Front())
+}
+
+func (f *fair) Evict(txn *message.Transaction) *message.Transaction {
+	var victim identity.NodeID
+	max := 0
+	for client, q := range f.queues {
+		if q.Len() > max {
+			victim, max = client, q.Len()
+		}
+	}
+	// the client of txn is to take no more than its share
+	pending := 0
+	if q, ok := f.queues[txn.Command.ClientID]; ok {
+		pending = q.Len()
+	}
+	if max <= pending+1 {
+		return nil
+	}
+	return f.remove(victim, f.queues[victim].Back())
+}
+
+func (f *fair) Remove(id string) *message.Transaction {
+	e, ok := f.index[id]
+	if !ok {
+		return nil
+	}
+	return f.remove(e.Value.(*message.Transaction).Command.ClientID, e)
+}
+
+func (f *fair) Len() int {
+	return len(f.index)
+}
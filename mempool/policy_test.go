@@ -0,0 +1,121 @@
+package mempool
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+func txn(id string, client identity.NodeID, fee int) *message.Transaction {
+	return &message.Transaction{
+		ID:         id,
+		Command:    db.Command{ClientID: client},
+		Properties: map[string]string{FeeProperty: strconv.Itoa(fee)},
+	}
+}
+
+func ids(b *Backend) []string {
+	var ids []string
+	for _, t := range b.some(100) {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestFIFORejectsWhenFull(t *testing.T) {
+	b := NewBackend(2, NewPolicy(FIFO))
+	b.insertBack(txn("a", "1", 0))
+	b.insertBack(txn("b", "1", 0))
+	evicted, err := b.insertBack(txn("c", "1", 0))
+	require.Nil(t, evicted)
+	require.Equal(t, ErrFull, err)
+	b.insertFront(txn("z", "1", 0))
+	require.Equal(t, []string{"z", "a", "b"}, ids(b))
+	// a rejected transaction may be submitted again
+	_, err = b.insertBack(txn("c", "1", 0))
+	require.NoError(t, err)
+}
+
+func TestPriority(t *testing.T) {
+	b := NewBackend(3, NewPolicy(PRIORITY))
+	b.insertBack(txn("a", "1", 5))
+	b.insertBack(txn("b", "1", 1))
+	b.insertBack(txn("c", "1", 5))
+	evicted, err := b.insertBack(txn("d", "1", 3))
+	require.NoError(t, err)
+	require.Equal(t, "b", evicted[0].ID)
+	_, err = b.insertBack(txn("e", "1", 3))
+	require.Equal(t, ErrFull, err)
+	b.insertFront(txn("f", "1", 5))
+	require.Equal(t, []string{"f", "a", "c", "d"}, ids(b))
+	// the evicted transaction may be submitted again
+	_, err = b.insertBack(txn("b", "1", 1))
+	require.NoError(t, err)
+}
+
+func TestFair(t *testing.T) {
+	b := NewBackend(4, NewPolicy(FAIR))
+	b.insertBack(txn("a1", "a", 0))
+	b.insertBack(txn("a2", "a", 0))
+	b.insertBack(txn("a3", "a", 0))
+	b.insertBack(txn("b1", "b", 0))
+	evicted, err := b.insertBack(txn("c1", "c", 0))
+	require.NoError(t, err)
+	require.Equal(t, "a3", evicted[0].ID)
+	evicted, err = b.insertBack(txn("b2", "b", 0))
+	require.Nil(t, evicted)
+	require.Equal(t, ErrFull, err)
+	require.Equal(t, []string{"a1", "b1", "c1", "a2"}, ids(b))
+}
+
+func TestCommittedPurgesPending(t *testing.T) {
+	for _, policy := range []string{FIFO, PRIORITY, FAIR} {
+		b := NewBackend(0, NewPolicy(policy))
+		b.insertBack(txn("a", "1", 1))
+		b.insertBack(txn("b", "2", 2))
+		b.insertBack(txn("c", "1", 3))
+		removed := b.committed([]*message.Transaction{txn("b", "2", 2), txn("x", "3", 0)})
+		require.Len(t, removed, 1, policy)
+		require.Equal(t, "b", removed[0].ID, policy)
+		require.Equal(t, 2, b.Size(), policy)
+		require.ElementsMatch(t, []string{"a", "c"}, ids(b), policy)
+		require.False(t, b.insertFront(txn("b", "2", 2)), policy)
+	}
+}
+
+func TestByteLimits(t *testing.T) {
+	sized := func(id string, fee, n int) *message.Transaction {
+		tx := txn(id, "1", fee)
+		tx.Command.Value = make([]byte, n-len(id)-8)
+		return tx
+	}
+	b := NewBackend(0, NewPolicy(PRIORITY))
+	b.limitBytes(50, 100)
+	_, err := b.insertBack(sized("big", 1, 51))
+	require.Equal(t, ErrTooLarge, err)
+	b.insertBack(sized("a", 1, 40))
+	b.insertBack(sized("b", 2, 40))
+	require.Equal(t, 80, b.Bytes())
+	// a lower fee finds no room and nothing is evicted
+	_, err = b.insertBack(sized("c", 0, 30))
+	require.Equal(t, ErrFull, err)
+	require.Equal(t, 80, b.Bytes())
+	// a higher fee evicts as many as it takes
+	evicted, err := b.insertBack(sized("d", 3, 50))
+	require.NoError(t, err)
+	require.Len(t, evicted, 1)
+	require.Equal(t, "a", evicted[0].ID)
+	require.Equal(t, 90, b.Bytes())
+	evicted, err = b.insertBack(sized("e", 4, 50))
+	require.NoError(t, err)
+	require.Len(t, evicted, 1)
+	require.Equal(t, "b", evicted[0].ID)
+	require.Len(t, b.take(10, 60), 1)
+	require.Equal(t, 50, b.Bytes())
+	b.committed([]*message.Transaction{txn("d", "1", 0)})
+	require.Equal(t, 0, b.Bytes())
+}
@@ -1,32 +1,119 @@
 package mempool
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/gitferry/bamboo/config"
 	"github.com/gitferry/bamboo/message"
 )
 
 type Producer struct {
-	mempool *MemPool
+	mempool  *MemPool
+	batching Batching
 }
 
 func NewProducer() *Producer {
 	return &Producer{
-		mempool: NewMemPool(),
+		mempool:  NewMemPool(),
+		batching: NewBatching(config.GetConfig().Batching),
 	}
 }
 
+// GeneratePayload takes the transactions of the next block as the batching policy decides
 func (pd *Producer) GeneratePayload() []*message.Transaction {
-	return pd.mempool.some(config.Configuration.BSize)
+	n := pd.batching.Next(pd.mempool.Size())
+	if n == 0 {
+		return nil
+	}
+	return pd.mempool.take(n, pd.maxBytes(pd.batching.Bytes()))
+}
+
+// maxBytes returns the smaller of the payload bytes and the limit of a block, no limit if both are 0
+func (pd *Producer) maxBytes(bytes int) int {
+	limit := config.GetConfig().MaxBlockBytes
+	if bytes == 0 || limit > 0 && limit < bytes {
+		return limit
+	}
+	return bytes
+}
+
+// Round tells the batching policy the duration of the last view
+func (pd *Producer) Round(d time.Duration) {
+	pd.batching.Round(d)
+}
+
+// BlockLimit returns the number of transactions the next block is filled up to
+func (pd *Producer) BlockLimit() int {
+	return pd.batching.Limit()
+}
+
+// Take removes and returns up to n transactions in the order of the policy, within the bytes of a block
+func (pd *Producer) Take(n int) []*message.Transaction {
+	return pd.mempool.take(n, pd.maxBytes(0))
+}
+
+// AddTxn adds a new transaction, it returns ErrDuplicate or ErrCommitted if the transaction has been seen,
+// ErrTooLarge if it exceeds the limit of a transaction and ErrFull if the pool is full, or the transactions
+// evicted to make room for it
+func (pd *Producer) AddTxn(txn *message.Transaction) ([]*message.Transaction, error) {
+	return pd.mempool.addNew(txn)
 }
 
-func (pd *Producer) AddTxn(txn *message.Transaction) {
-	pd.mempool.addNew(txn)
+// CollectTxn puts back a transaction of a forked block, it returns false if the
+// transaction has been committed in another block
+func (pd *Producer) CollectTxn(txn *message.Transaction) bool {
+	return pd.mempool.addOld(txn)
 }
 
-func (pd *Producer) CollectTxn(txn *message.Transaction) {
-	pd.mempool.addOld(txn)
+// Committed tells the memory pool the transactions of a committed block, the pending
+// transactions of the same ids received by this replica are removed and returned
+func (pd *Producer) Committed(txns []*message.Transaction) []*message.Transaction {
+	return pd.mempool.committed(txns)
 }
 
 func (pd *Producer) TotalReceivedTxNo() int64 {
-	return pd.mempool.totalReceived
+	return pd.mempool.TotalReceived()
+}
+
+func (pd *Producer) Size() int {
+	return pd.mempool.Size()
+}
+
+// Bytes returns the payload bytes of the transactions in the memory pool
+func (pd *Producer) Bytes() int {
+	return pd.mempool.Bytes()
+}
+
+// CheckBytes validates a received payload against the byte limits of a transaction and of a
+// block, which honest proposers respect. One transaction is never too large for a block since
+// at least one is taken
+func CheckBytes(payload []*message.Transaction) error {
+	maxTx, maxBlock := config.GetConfig().MaxTxBytes, config.GetConfig().MaxBlockBytes
+	bytes := 0
+	for _, txn := range payload {
+		size := txn.Size()
+		if maxTx > 0 && size > maxTx {
+			return fmt.Errorf("transaction %v has %d bytes, the limit is %d", txn.ID, size, maxTx)
+		}
+		bytes += size
+	}
+	if maxBlock > 0 && bytes > maxBlock && len(payload) > 1 {
+		return fmt.Errorf("payload has %d bytes, the limit is %d", bytes, maxBlock)
+	}
+	return nil
+}
+
+// CheckSignatures verifies that every transaction of a received payload is signed by its
+// client if signed transactions are required, so that a proposer cannot forge commands
+func CheckSignatures(payload []*message.Transaction) error {
+	if !config.GetConfig().SignedTxs {
+		return nil
+	}
+	for _, txn := range payload {
+		if err := txn.Verify(); err != nil {
+			return fmt.Errorf("transaction %v: %v", txn.ID, err)
+		}
+	}
+	return nil
 }
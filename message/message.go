@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
 	"github.com/gitferry/bamboo/db"
 	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/types"
 )
 
 func init() {
@@ -15,6 +17,10 @@ func init() {
 	gob.Register(TransactionReply{})
 	gob.Register(Query{})
 	gob.Register(QueryReply{})
+	gob.Register(EvidenceQuery{})
+	gob.Register(EvidenceReply{})
+	gob.Register(CommittedQuery{})
+	gob.Register(CommittedReply{})
 	gob.Register(Read{})
 	gob.Register(ReadReply{})
 	gob.Register(Register{})
@@ -32,9 +38,20 @@ type Transaction struct {
 	Timestamp  time.Time
 	NodeID     identity.NodeID // forward by node
 	ID         string
+	PubKey     []byte                // public key of the client, its hash is the client id
+	Sig        crypto.Signature      // client signature of the command
 	C          chan TransactionReply // reply channel created by request receiver
 }
 
+// Size returns the payload bytes of the transaction, the bytes of its id, key, value and signature
+func (r *Transaction) Size() int {
+	size := len(r.ID) + 8 + len(r.Command.Value) + len(r.PubKey)
+	for _, b := range r.Sig {
+		size += len(b)
+	}
+	return size
+}
+
 // TransactionReply replies to current client session
 func (r *Transaction) Reply(reply TransactionReply) {
 	r.C <- reply
@@ -88,9 +105,86 @@ func (r *Query) Reply(reply QueryReply) {
 	r.C <- reply
 }
 
-// QueryReply cid and value of reading key
+// QueryReply holds the statistics of the replica
 type QueryReply struct {
-	Info string
+	Stats Stats
+}
+
+// Stats are the statistics of a replica, the counters are totals since the start
+type Stats struct {
+	Uptime          float64            `json:"uptime"` // seconds
+	View            types.View         `json:"view"`
+	Height          int                `json:"committed_height"`
+	MempoolSize     int                `json:"mempool_size"`
+	MempoolBytes    int                `json:"mempool_bytes"`
+	ReceivedTxs     int64              `json:"received_txs"`
+	CommittedTxs    uint64             `json:"committed_txs"`
+	CommittedBlocks uint64             `json:"committed_blocks"`
+	ProposedBlocks  uint64             `json:"proposed_blocks"`
+	ForkedBlocks    uint64             `json:"forked_blocks"`
+	Timeouts        uint64             `json:"timeouts"`
+	Throughput      map[string]float64 `json:"throughput"` // committed txs per second by window
+	Latency         LatencyStats       `json:"latency"`
+}
+
+// LatencyStats are the commit latencies in ms of the latest transactions submitted to the replica,
+// in every committed block whichever replica proposed it
+type LatencyStats struct {
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+	Max    float64 `json:"max"`
+}
+
+// MetricsQuery asks the replica for its metrics
+type MetricsQuery struct {
+	C chan MetricsReply
+}
+
+func (r *MetricsQuery) Reply(reply MetricsReply) {
+	r.C <- reply
+}
+
+// MetricsReply holds the metrics in the Prometheus text format
+type MetricsReply struct {
+	Metrics []byte
+}
+
+// EvidenceQuery asks the replica for the evidence of misbehaviour it has collected
+type EvidenceQuery struct {
+	C chan EvidenceReply
+}
+
+func (r *EvidenceQuery) Reply(reply EvidenceReply) {
+	r.C <- reply
+}
+
+// EvidenceReply holds the evidence by offender, encoded as json
+type EvidenceReply struct {
+	Evidence []byte
+}
+
+// CommittedQuery asks the replica for the blocks it committed from the given height on
+type CommittedQuery struct {
+	From int
+	C    chan CommittedReply
+}
+
+func (r *CommittedQuery) Reply(reply CommittedReply) {
+	r.C <- reply
+}
+
+// CommittedBlock is a block at its height in the committed chain of a replica
+type CommittedBlock struct {
+	Height int        `json:"height"`
+	View   types.View `json:"view"`
+	ID     string     `json:"id"`
+}
+
+// CommittedReply holds the committed blocks in height order
+type CommittedReply struct {
+	Blocks []CommittedBlock
 }
 
 /**************************
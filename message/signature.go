@@ -0,0 +1,61 @@
+package message
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+)
+
+// ErrUnsigned is returned for a transaction without the signature of its client
+var ErrUnsigned = errors.New("transaction is not signed")
+
+// ErrInvalidSignature is returned for a transaction not signed by the client it claims
+var ErrInvalidSignature = errors.New("invalid transaction signature")
+
+// ErrInvalidID is returned for a signed transaction whose id is not the one of its command
+var ErrInvalidID = errors.New("transaction id does not match its command")
+
+// FeeProperty is the transaction property holding its fee, a number signed along with the command
+const FeeProperty = "fee"
+
+// Digest returns the hash of the command and the fee a client signs
+func Digest(cmd db.Command, fee string) crypto.Hash {
+	msg := fmt.Sprintf("%v.%d.%d.%d.%s.", cmd.ClientID, cmd.CommandID, cmd.Key, len(fee), fee)
+	return crypto.NewSHA3_256().ComputeHash(append([]byte(msg), cmd.Value...))
+}
+
+// Sign signs the command and the fee with the client key, the client id of the command must be the one of the key
+func (r *Transaction) Sign(priv crypto.PrivateKey) error {
+	sig, err := priv.Sign(Digest(r.Command, r.Properties[FeeProperty]), nil)
+	if err != nil {
+		return err
+	}
+	r.PubKey = crypto.EncodePublicKey(priv.PublicKey())
+	r.Sig = sig
+	return nil
+}
+
+// Verify checks that the command and the fee are signed by the key of its client and that the
+// id, which blocks commit to instead of the command, is the one of the command
+func (r *Transaction) Verify() error {
+	if len(r.PubKey) == 0 || len(r.Sig) == 0 {
+		return ErrUnsigned
+	}
+	if r.ID != fmt.Sprintf("%v.%v", r.Command.ClientID, r.Command.CommandID) {
+		return ErrInvalidID
+	}
+	if len(r.Sig) != 2 || r.Command.ClientID != crypto.KeyID(r.PubKey) {
+		return ErrInvalidSignature
+	}
+	pub, err := crypto.DecodePublicKey(r.PubKey)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	ok, err := pub.Verify(r.Sig, Digest(r.Command, r.Properties[FeeProperty]))
+	if err != nil || !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
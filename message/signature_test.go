@@ -0,0 +1,67 @@
+package message
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/stretchr/testify/require"
+)
+
+func signed(t *testing.T) *Transaction {
+	key, err := crypto.NewClientKey()
+	require.NoError(t, err)
+	id := crypto.KeyID(crypto.EncodePublicKey(key.PublicKey()))
+	txn := &Transaction{ID: string(id) + ".1", Command: db.Command{Key: 1, Value: db.Value("v"), ClientID: id, CommandID: 1}}
+	require.NoError(t, txn.Sign(key))
+	return txn
+}
+
+func TestSignedTransaction(t *testing.T) {
+	txn := signed(t)
+	require.NoError(t, txn.Verify())
+
+	// the text forms sent over http decode to the same signature
+	pub, err := hex.DecodeString(hex.EncodeToString(txn.PubKey))
+	require.NoError(t, err)
+	sig, err := crypto.DecodeSignature(crypto.EncodeSignature(txn.Sig))
+	require.NoError(t, err)
+	copied := &Transaction{ID: txn.ID, Command: txn.Command, PubKey: pub, Sig: sig}
+	require.NoError(t, copied.Verify())
+
+	require.Equal(t, ErrUnsigned, (&Transaction{Command: txn.Command}).Verify())
+}
+
+func TestForgedTransaction(t *testing.T) {
+	// a tampered command
+	txn := signed(t)
+	txn.Command.Value = db.Value("w")
+	require.Equal(t, ErrInvalidSignature, txn.Verify())
+
+	// a fee raised after signing, the fee is signed with the command
+	txn = signed(t)
+	txn.Properties = map[string]string{FeeProperty: "100"}
+	require.Equal(t, ErrInvalidSignature, txn.Verify())
+
+	// a command of another client signed with a valid key
+	txn = signed(t)
+	txn.Command.ClientID = "1"
+	txn.ID = "1.1"
+	require.Equal(t, ErrInvalidSignature, txn.Verify())
+
+	// the signature of another command
+	txn, other := signed(t), signed(t)
+	txn.Sig = other.Sig
+	require.Equal(t, ErrInvalidSignature, txn.Verify())
+
+	// a signed command under the id of another one
+	txn = signed(t)
+	txn.ID = txn.ID + "0"
+	require.Equal(t, ErrInvalidID, txn.Verify())
+
+	// garbage in the signature
+	txn = signed(t)
+	txn.Sig = crypto.Signature{[]byte("x"), []byte("y")}
+	require.Equal(t, ErrInvalidSignature, txn.Verify())
+}
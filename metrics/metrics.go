@@ -0,0 +1,300 @@
+// Package metrics provides thread-safe counters, gauges and histograms
+// exposed in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets are the default histogram buckets in seconds
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that writes its samples
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry holds the metrics of one replica
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.collectors[c.name()]; exists {
+		panic("metrics: duplicate metric " + c.name())
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteTo writes all metrics sorted by name in the Prometheus text format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+	sort.Strings(names)
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, name := range names {
+		r.mu.RLock()
+		c := r.collectors[name]
+		r.mu.RUnlock()
+		c.write(cw)
+	}
+	return cw.n, cw.w.(*bufio.Writer).Flush()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type desc struct {
+	fqName string
+	help   string
+	kind   string
+}
+
+func (d desc) name() string {
+	return d.fqName
+}
+
+func (d desc) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.fqName, d.help, d.fqName, d.kind)
+}
+
+func format(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Counter only goes up
+type Counter struct {
+	bits uint64
+}
+
+// Inc adds one
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		if atomic.CompareAndSwapUint64(&c.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+type counter struct {
+	desc
+	*Counter
+}
+
+func (c *counter) write(w io.Writer) {
+	c.header(w)
+	fmt.Fprintf(w, "%s %s\n", c.fqName, format(c.Value()))
+}
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &counter{desc{name, help, "counter"}, new(Counter)}
+	r.register(c)
+	return c.Counter
+}
+
+// CounterVec is a family of counters told apart by the value of one label
+type CounterVec struct {
+	desc
+	label    string
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// NewCounterVec registers a counter family with the label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{
+		desc:     desc{name, help, "counter"},
+		label:    label,
+		counters: make(map[string]*Counter),
+	}
+	r.register(c)
+	return c
+}
+
+// With returns the counter of the label value
+func (c *CounterVec) With(value string) *Counter {
+	c.mu.RLock()
+	counter, ok := c.counters[value]
+	c.mu.RUnlock()
+	if ok {
+		return counter
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if counter, ok = c.counters[value]; !ok {
+		counter = new(Counter)
+		c.counters[value] = counter
+	}
+	return counter
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.header(w)
+	c.mu.RLock()
+	values := make([]string, 0, len(c.counters))
+	for v := range c.counters {
+		values = append(values, v)
+	}
+	c.mu.RUnlock()
+	sort.Strings(values)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s%s %s\n", c.fqName, labels(c.label, v), format(c.With(v).Value()))
+	}
+}
+
+// Gauge goes up and down
+type Gauge struct {
+	bits uint64
+}
+
+// Set sets the value
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+type gauge struct {
+	desc
+	value func() float64
+}
+
+func (g *gauge) write(w io.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.fqName, format(g.value()))
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := new(Gauge)
+	r.register(&gauge{desc{name, help, "gauge"}, g.Value})
+	return g
+}
+
+// NewGaugeFunc registers a gauge whose value is taken from f at every scrape
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&gauge{desc{name, help, "gauge"}, f})
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	desc
+	upper  []float64
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds in increasing order
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		desc:   desc{name, help, "histogram"},
+		upper:  buckets,
+		counts: make([]uint64, len(buckets)),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	counts := make([]uint64, len(h.counts))
+	copy(counts, h.counts)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	h.header(w)
+	var cumulative uint64
+	for i, upper := range h.upper {
+		cumulative += counts[i]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, labels("le", format(upper)), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", h.fqName, labels("le", "+Inf"), count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.fqName, format(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.fqName, count)
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("requests_total", "Requests.")
+	v := r.NewCounterVec("bytes_total", "Bytes by type.", "type")
+	g := r.NewGauge("view", "Current view.")
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Inc()
+			v.With("Block").Add(10)
+		}()
+	}
+	wg.Wait()
+	v.With("Vote").Add(1)
+	g.Set(7)
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	require.NoError(t, err)
+	require.Equal(t, `# HELP bytes_total Bytes by type.
+# TYPE bytes_total counter
+bytes_total{type="Block"} 1000
+bytes_total{type="Vote"} 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total 100
+# HELP view Current view.
+# TYPE view gauge
+view 7
+`, b.String())
+}
+
+func TestDuplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("a", "")
+	require.Panics(t, func() { r.NewGauge("a", "") })
+}
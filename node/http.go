@@ -1,16 +1,29 @@
 package node
 
 import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"go.uber.org/atomic"
+
 	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
 	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/mempool"
 	"github.com/gitferry/bamboo/message"
 )
 
@@ -20,8 +33,18 @@ import (
 const (
 	HTTPClientID  = "Id"
 	HTTPCommandID = "Cid"
+	HTTPDelay     = "Delay"     // time the transaction took to commit at the replica, in nanoseconds
+	HTTPFee       = "Fee"       // fee of the transaction, ordering the mempool by priority
+	HTTPPubKey    = "Pubkey"    // hex of the client public key, its hash is the client id
+	HTTPSignature = "Signature" // client signature of the command, r and s in decimal
 )
 
+// ErrTimeout is replied when a transaction is not committed within the commit timeout
+var ErrTimeout = errors.New("transaction not committed in time")
+
+// anonymous counts the requests without client id
+var anonymous atomic.Int64
+
 var ppFree = sync.Pool{
 	New: func() interface{} {
 		return make(chan message.TransactionReply, 1)
@@ -32,7 +55,12 @@ var ppFree = sync.Pool{
 func (n *node) http() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", n.handleRoot)
+	mux.HandleFunc("/batch", n.handleBatch)
+	mux.HandleFunc("/stream", n.handleStream)
 	mux.HandleFunc("/query", n.handleQuery)
+	mux.HandleFunc("/metrics", n.handleMetrics)
+	mux.HandleFunc("/evidence", n.handleEvidence)
+	mux.HandleFunc("/committed", n.handleCommitted)
 	mux.HandleFunc("/slow", n.handleSlow)
 	mux.HandleFunc("/flaky", n.handleFlaky)
 	mux.HandleFunc("/crash", n.handleCrash)
@@ -57,7 +85,56 @@ func (n *node) handleQuery(w http.ResponseWriter, r *http.Request) {
 	query.C = make(chan message.QueryReply)
 	n.TxChan <- query
 	reply := <-query.C
-	_, err := io.WriteString(w, reply.Info)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(reply.Stats)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (n *node) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var query message.MetricsQuery
+	query.C = make(chan message.MetricsReply)
+	n.TxChan <- query
+	reply := <-query.C
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, err := w.Write(reply.Metrics)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (n *node) handleEvidence(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var query message.EvidenceQuery
+	query.C = make(chan message.EvidenceReply)
+	n.TxChan <- query
+	reply := <-query.C
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write(reply.Evidence)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// handleCommitted replies the committed block ids by height, from the height given by "from"
+func (n *node) handleCommitted(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var query message.CommittedQuery
+	if from := r.URL.Query().Get("from"); from != "" {
+		var err error
+		query.From, err = strconv.Atoi(from)
+		if err != nil {
+			http.Error(w, "invalid height", http.StatusBadRequest)
+			return
+		}
+	}
+	query.C = make(chan message.CommittedReply)
+	n.TxChan <- query
+	reply := <-query.C
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(reply.Blocks)
 	if err != nil {
 		log.Error(err)
 	}
@@ -67,28 +144,137 @@ func (n *node) handleRoot(w http.ResponseWriter, r *http.Request) {
 	var req message.Transaction
 	defer r.Body.Close()
 
-	v, _ := ioutil.ReadAll(r.Body)
-	//log.Debugf("[%v] payload is %x", n.id, v)
-	req.Command.Value = v
-	req.C = ppFree.Get().(chan message.TransactionReply)
+	// the key is the path of the url
+	k, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+	if err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	req.Command.Key = db.Key(k)
+	// reads are GET requests and writes carry the value in the body
+	if r.Method != http.MethodGet {
+		body := io.Reader(r.Body)
+		if limit := config.GetConfig().MaxTxBytes; limit > 0 {
+			body = http.MaxBytesReader(w, r.Body, int64(limit))
+		}
+		v, err := ioutil.ReadAll(body)
+		if err != nil {
+			http.Error(w, mempool.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(v) == 0 {
+			http.Error(w, "empty value", http.StatusBadRequest)
+			return
+		}
+		//log.Debugf("[%v] payload is %x", n.id, v)
+		req.Command.Value = v
+	}
+	req.Command.ClientID = identity.NodeID(r.Header.Get(HTTPClientID))
+	req.Command.CommandID, _ = strconv.Atoi(r.Header.Get(HTTPCommandID))
+	if fee := r.Header.Get(HTTPFee); fee != "" {
+		req.Properties = map[string]string{mempool.FeeProperty: fee}
+	}
+	req.PubKey, req.Sig, err = signature(r.Header.Get(HTTPPubKey), r.Header.Get(HTTPSignature))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	n.submit(&req)
+
+	// wait for the transaction to be committed
+	reply, ok := wait(r.Context(), &req)
+	if !ok && reply.Err != ErrTimeout {
+		// the client is gone
+		return
+	}
+	if ok {
+		// a channel given up on may still get the late reply
+		ppFree.Put(req.C)
+	}
+	log.Debugf("[%v] tx %v delay is %v", n.id, req.ID, reply.Delay)
+
+	if code := status(reply.Err); code != http.StatusOK {
+		http.Error(w, reply.Err.Error(), code)
+		return
+	}
+	w.Header().Set(HTTPDelay, strconv.FormatInt(reply.Delay.Nanoseconds(), 10))
+	_, err = w.Write(reply.Value)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// submit names the transaction and hands it to the replica, the reply is sent to req.C
+func (n *node) submit(req *message.Transaction) {
+	if req.C == nil {
+		req.C = ppFree.Get().(chan message.TransactionReply)
+	}
 	req.NodeID = n.id
 	req.Timestamp = time.Now()
-	req.ID = r.RequestURI
-	n.TxChan <- req
+	if req.Command.ClientID != "" {
+		req.ID = fmt.Sprintf("%v.%v", req.Command.ClientID, req.Command.CommandID)
+	} else {
+		// anonymous requests are named by the receiving node
+		req.ID = fmt.Sprintf("%v.%v", n.id, anonymous.Inc())
+	}
+	n.TxChan <- *req
+}
 
-	//reply := <-req.C
-	//
-	//log.Debugf("[%v] tx %v delay is %v", n.id, req.ID, strconv.Itoa(int(reply.Delay.Nanoseconds())))
+// wait waits for the reply of the submitted transaction until the request is canceled or the
+// commit timeout expires, it returns false with the reason in the error of the reply if it gave up
+func wait(ctx context.Context, txn *message.Transaction) (message.TransactionReply, bool) {
+	var timeout <-chan time.Time
+	if t := config.GetConfig().CommitTimeout; t > 0 {
+		timer := time.NewTimer(time.Duration(t) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case reply := <-txn.C:
+		return reply, true
+	case <-timeout:
+		return message.TransactionReply{Err: ErrTimeout}, false
+	case <-ctx.Done():
+		return message.TransactionReply{Err: ctx.Err()}, false
+	}
+}
 
-	//if reply.Err != nil {
-	//	http.Error(w, reply.Err.Error(), http.StatusInternalServerError)
-	//	return
-	//}
-	//w.Header().Set(HTTPCommandID, strconv.Itoa(int(reply.Delay.Nanoseconds())))
-	//_, err := io.WriteString(w, string(reply.Delay.Nanoseconds()))
-	//if err != nil {
-	//	log.Error(err)
-	//}
+// signature decodes the public key and signature of a transaction, both are empty if it is not signed
+func signature(pub, sig string) ([]byte, crypto.Signature, error) {
+	if pub == "" && sig == "" {
+		return nil, nil, nil
+	}
+	key, err := hex.DecodeString(pub)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	s, err := crypto.DecodeSignature(sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, s, nil
+}
+
+// status returns the http status code of the reply error
+func status(err error) int {
+	switch err {
+	case nil:
+		return http.StatusOK
+	case mempool.ErrFull, mempool.ErrEvicted:
+		// overloaded, the client may retry later
+		return http.StatusServiceUnavailable
+	case mempool.ErrTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ErrTimeout:
+		// the transaction may still commit, the client may retry with the same command id
+		return http.StatusGatewayTimeout
+	case message.ErrUnsigned:
+		return http.StatusUnauthorized
+	case message.ErrInvalidSignature:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
 }
 
 func (n *node) handleCrash(w http.ResponseWriter, r *http.Request) {
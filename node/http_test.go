@@ -0,0 +1,75 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestNode makes a node without sockets, its transactions are read from TxChan
+func newTestNode() *node {
+	return &node{
+		id:     "1",
+		TxChan: make(chan interface{}, 16),
+	}
+}
+
+// commit replies the next n transactions submitted to the node with their values
+func commit(n *node, count int) {
+	for i := 0; i < count; i++ {
+		txn := (<-n.TxChan).(message.Transaction)
+		txn.Reply(message.TransactionReply{Command: txn.Command, Value: txn.Command.Value, Delay: time.Millisecond})
+	}
+}
+
+func TestHandleRoot(t *testing.T) {
+	n := newTestNode()
+	go commit(n, 1)
+	w := httptest.NewRecorder()
+	n.handleRoot(w, httptest.NewRequest(http.MethodPut, "/1", strings.NewReader("v")))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "v", w.Body.String())
+	require.Equal(t, "1000000", w.Header().Get(HTTPDelay))
+}
+
+func TestHandleRootTimeout(t *testing.T) {
+	defer func(timeout int) { config.Configuration.CommitTimeout = timeout }(config.Configuration.CommitTimeout)
+	config.Configuration.CommitTimeout = 10
+
+	n := newTestNode()
+	w := httptest.NewRecorder()
+	n.handleRoot(w, httptest.NewRequest(http.MethodPut, "/1", strings.NewReader("v")))
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	// the late reply does not block the replica
+	txn := (<-n.TxChan).(message.Transaction)
+	done := make(chan struct{})
+	go func() {
+		txn.Reply(message.TransactionReply{Command: txn.Command})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("late reply blocked")
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	defer func(timeout int) { config.Configuration.CommitTimeout = timeout }(config.Configuration.CommitTimeout)
+	config.Configuration.CommitTimeout = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	txn := &message.Transaction{C: make(chan message.TransactionReply, 1)}
+	cancel()
+	reply, ok := wait(ctx, txn)
+	require.False(t, ok)
+	require.Equal(t, context.Canceled, reply.Err)
+}
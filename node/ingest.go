@@ -0,0 +1,322 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+)
+
+// StreamHeader holds the id of the stream in the response opening it
+const StreamHeader = "X-Stream-ID"
+
+// streamWindow bounds the submissions of a stream waiting for their acks if max_batch is 0
+const streamWindow = 1024
+
+// Submission is a transaction submitted to /batch or /stream, a read has no value
+type Submission struct {
+	Key       db.Key          `json:"key"`
+	Value     db.Value        `json:"value,omitempty"`
+	ClientID  identity.NodeID `json:"client_id,omitempty"`
+	CommandID int             `json:"command_id"`
+	Fee       string          `json:"fee,omitempty"`
+	PubKey    string          `json:"pubkey,omitempty"`    // hex of the client public key
+	Signature string          `json:"signature,omitempty"` // r and s of the signature in decimal
+}
+
+// Ack answers a submission once it is committed or rejected, the status is the one
+// the transaction would get from the single request endpoint
+type Ack struct {
+	ID        string   `json:"id"`
+	CommandID int      `json:"command_id"`
+	Status    int      `json:"status"`
+	Value     db.Value `json:"value,omitempty"`
+	Delay     int64    `json:"delay,omitempty"` // nanoseconds until the commitment at the replica
+	Error     string   `json:"error,omitempty"`
+}
+
+// transaction checks the submission and makes its transaction, nil with the ack if it is invalid
+func (s *Submission) transaction() (*message.Transaction, *Ack) {
+	txn := &message.Transaction{
+		Command: db.Command{
+			Key:       s.Key,
+			Value:     s.Value,
+			ClientID:  s.ClientID,
+			CommandID: s.CommandID,
+		},
+		C: make(chan message.TransactionReply, 1),
+	}
+	if s.Fee != "" {
+		txn.Properties = map[string]string{mempool.FeeProperty: s.Fee}
+	}
+	if limit := config.GetConfig().MaxTxBytes; limit > 0 && len(s.Value) > limit {
+		return nil, &Ack{CommandID: s.CommandID, Status: http.StatusRequestEntityTooLarge, Error: mempool.ErrTooLarge.Error()}
+	}
+	var err error
+	txn.PubKey, txn.Sig, err = signature(s.PubKey, s.Signature)
+	if err != nil {
+		return nil, &Ack{CommandID: s.CommandID, Status: http.StatusBadRequest, Error: err.Error()}
+	}
+	return txn, nil
+}
+
+// ack waits for the reply of the submitted transaction
+func ack(ctx context.Context, txn *message.Transaction) *Ack {
+	reply, _ := wait(ctx, txn)
+	a := &Ack{ID: txn.ID, CommandID: txn.Command.CommandID, Status: status(reply.Err)}
+	if reply.Err != nil {
+		a.Error = reply.Err.Error()
+		return a
+	}
+	a.Value = reply.Value
+	a.Delay = reply.Delay.Nanoseconds()
+	return a
+}
+
+// handleBatch submits a json array of transactions and replies the array of their acks
+// in the same order once all of them are committed or rejected
+func (n *node) handleBatch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		http.Error(w, "batches are posted", http.StatusMethodNotAllowed)
+		return
+	}
+	body := io.Reader(r.Body)
+	if limit := config.GetConfig().MaxBatchBytes; limit > 0 {
+		body = http.MaxBytesReader(w, r.Body, int64(limit))
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, "batch too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var subs []Submission
+	if err := json.Unmarshal(data, &subs); err != nil {
+		http.Error(w, "invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit := config.GetConfig().MaxBatch; limit > 0 && len(subs) > limit {
+		http.Error(w, "too many transactions in the batch", http.StatusRequestEntityTooLarge)
+		return
+	}
+	acks := make([]*Ack, len(subs))
+	txns := make([]*message.Transaction, len(subs))
+	for i := range subs {
+		txns[i], acks[i] = subs[i].transaction()
+		if txns[i] != nil {
+			n.submit(txns[i])
+		}
+	}
+	for i, txn := range txns {
+		if txn != nil {
+			acks[i] = ack(r.Context(), txn)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(acks); err != nil {
+		log.Error(err)
+	}
+}
+
+// handleStream serves the streams of submissions and acks: a GET opens a stream and is answered
+// with its id in the StreamHeader and the acks of its submissions as newline delimited json, in the
+// order of commitment. Submissions are posted as newline delimited json to /stream?id= while the acks
+// are streamed, a DELETE of /stream?id= tells that no more follow and the acks end once all are written
+func (n *node) handleStream(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		n.openStream(w, r)
+	case http.MethodPost:
+		n.postStream(w, r)
+	case http.MethodDelete:
+		s := n.streams.get(r.URL.Query().Get("id"))
+		if s == nil {
+			http.Error(w, "unknown stream", http.StatusNotFound)
+			return
+		}
+		s.close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "streams are opened, posted to and deleted", http.StatusMethodNotAllowed)
+	}
+}
+
+func (n *node) openStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streams are not supported", http.StatusInternalServerError)
+		return
+	}
+	s := newStream(r.Context())
+	id := n.streams.add(s)
+	defer n.streams.remove(id)
+	w.Header().Set(StreamHeader, id)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for !s.done() {
+		select {
+		case a := <-s.acks:
+			if err := enc.Encode(a); err != nil {
+				log.Debugf("[%v] cannot write the ack of %v: %v", n.id, a.ID, err)
+				return
+			}
+			flusher.Flush()
+			<-s.inflight
+		case <-s.wake:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// postStream submits the posted submissions to the stream, a submission is read once fewer
+// than the limit of the stream wait for their acks to be written
+func (n *node) postStream(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	s := n.streams.get(r.URL.Query().Get("id"))
+	if s == nil {
+		http.Error(w, "unknown stream", http.StatusNotFound)
+		return
+	}
+	if !s.post() {
+		http.Error(w, "the stream is closed", http.StatusConflict)
+		return
+	}
+	defer s.posted()
+	dec := json.NewDecoder(r.Body)
+	for {
+		var sub Submission
+		if err := dec.Decode(&sub); err != nil {
+			if err != io.EOF {
+				http.Error(w, "invalid submission: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			break
+		}
+		select {
+		case s.inflight <- struct{}{}:
+		case <-s.ctx.Done():
+			http.Error(w, "the stream is gone", http.StatusGone)
+			return
+		}
+		txn, a := sub.transaction()
+		if txn == nil {
+			s.acks <- a
+			continue
+		}
+		n.submit(txn)
+		go func() {
+			s.acks <- ack(s.ctx, txn)
+		}()
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// stream holds the acks of the submissions posted to a stream until they are written
+type stream struct {
+	ctx      context.Context // of the request the acks are written to
+	acks     chan *Ack
+	inflight chan struct{} // a slot for each submission whose ack is not written yet
+	wake     chan struct{} // the sending side changed
+
+	mu     sync.Mutex
+	posts  int  // posts being read
+	closed bool // no more posts follow
+}
+
+func newStream(ctx context.Context) *stream {
+	limit := config.GetConfig().MaxBatch
+	if limit <= 0 {
+		limit = streamWindow
+	}
+	// the acks never outnumber the slots, sending one does not block
+	return &stream{
+		ctx:      ctx,
+		acks:     make(chan *Ack, limit),
+		inflight: make(chan struct{}, limit),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// post returns false if the stream is closed, otherwise posted must be called once the post is read
+func (s *stream) post() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.posts++
+	return true
+}
+
+func (s *stream) posted() {
+	s.mu.Lock()
+	s.posts--
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *stream) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *stream) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// done returns true once the stream is closed and every ack is written
+func (s *stream) done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed && s.posts == 0 && len(s.inflight) == 0
+}
+
+// streams are the open streams by id
+type streams struct {
+	sync.Mutex
+	next int
+	open map[string]*stream
+}
+
+func (ss *streams) add(s *stream) string {
+	ss.Lock()
+	defer ss.Unlock()
+	if ss.open == nil {
+		ss.open = make(map[string]*stream)
+	}
+	ss.next++
+	id := strconv.Itoa(ss.next)
+	ss.open[id] = s
+	return id
+}
+
+func (ss *streams) get(id string) *stream {
+	ss.Lock()
+	defer ss.Unlock()
+	return ss.open[id]
+}
+
+func (ss *streams) remove(id string) {
+	ss.Lock()
+	defer ss.Unlock()
+	delete(ss.open, id)
+}
@@ -0,0 +1,218 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmissionTransaction(t *testing.T) {
+	s := Submission{Key: 1, Value: db.Value("v"), ClientID: "c", CommandID: 2, Fee: "5"}
+	txn, a := s.transaction()
+	require.Nil(t, a)
+	require.Equal(t, db.Command{Key: 1, Value: db.Value("v"), ClientID: "c", CommandID: 2}, txn.Command)
+	require.Equal(t, "5", txn.Properties[mempool.FeeProperty])
+	require.NotNil(t, txn.C)
+	require.Nil(t, txn.Sig)
+
+	s.Value = make(db.Value, config.GetConfig().MaxTxBytes+1)
+	txn, a = s.transaction()
+	require.Nil(t, txn)
+	require.Equal(t, http.StatusRequestEntityTooLarge, a.Status)
+	require.Equal(t, 2, a.CommandID)
+
+	s.Value = db.Value("v")
+	s.PubKey, s.Signature = "not hex", "1,2"
+	txn, a = s.transaction()
+	require.Nil(t, txn)
+	require.Equal(t, http.StatusBadRequest, a.Status)
+
+	key, err := crypto.NewClientKey()
+	require.NoError(t, err)
+	s.ClientID = crypto.KeyID(crypto.EncodePublicKey(key.PublicKey()))
+	signed := message.Transaction{
+		Command:    db.Command{Key: 1, Value: db.Value("v"), ClientID: s.ClientID, CommandID: 2},
+		Properties: map[string]string{message.FeeProperty: "5"},
+	}
+	require.NoError(t, signed.Sign(key))
+	s.PubKey, s.Signature = hex.EncodeToString(signed.PubKey), crypto.EncodeSignature(signed.Sig)
+	txn, a = s.transaction()
+	require.Nil(t, a)
+	// the id is set on submission
+	require.Equal(t, message.ErrInvalidID, txn.Verify())
+	n := newTestNode()
+	n.submit(txn)
+	require.NoError(t, txn.Verify())
+	// the fee is signed
+	txn.Properties[mempool.FeeProperty] = "6"
+	require.Equal(t, message.ErrInvalidSignature, txn.Verify())
+}
+
+func postBatch(n *node, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	n.handleBatch(w, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	return w
+}
+
+func TestHandleBatch(t *testing.T) {
+	n := newTestNode()
+	go commit(n, 2)
+	w := postBatch(n, `[{"key":1,"value":"YQ==","client_id":"c","command_id":1},`+
+		`{"key":2,"client_id":"c","command_id":2,"pubkey":"x","signature":"1,2"},`+
+		`{"key":3,"value":"Yw==","client_id":"c","command_id":3}]`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var acks []Ack
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&acks))
+	require.Len(t, acks, 3)
+	require.Equal(t, Ack{ID: "c.1", CommandID: 1, Status: http.StatusOK, Value: db.Value("a"), Delay: 1000000}, acks[0])
+	// the invalid submission is rejected alone, in its place
+	require.Equal(t, http.StatusBadRequest, acks[1].Status)
+	require.Equal(t, 2, acks[1].CommandID)
+	require.Equal(t, "c.3", acks[2].ID)
+	require.Equal(t, db.Value("c"), acks[2].Value)
+}
+
+func TestHandleBatchLimits(t *testing.T) {
+	defer func(c config.Config) { config.Configuration = c }(config.Configuration)
+	config.Configuration.MaxBatch = 2
+	config.Configuration.MaxBatchBytes = 200
+	n := newTestNode()
+
+	w := httptest.NewRecorder()
+	n.handleBatch(w, httptest.NewRequest(http.MethodGet, "/batch", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	require.Equal(t, http.StatusBadRequest, postBatch(n, `[{"key":`).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, postBatch(n, `[{"key":1},{"key":2},{"key":3}]`).Code)
+	require.Equal(t, http.StatusRequestEntityTooLarge, postBatch(n, `[{"key":1,"value":"`+strings.Repeat("A", 200)+`"}]`).Code)
+	// nothing is submitted from a rejected batch
+	require.Empty(t, n.TxChan)
+}
+
+// openStream opens a stream on the server and returns its url with the decoder of its acks
+func openStream(t *testing.T, server *httptest.Server) (string, *json.Decoder) {
+	r, err := http.Get(server.URL + "/stream")
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Body.Close() })
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	id := r.Header.Get(StreamHeader)
+	require.NotEmpty(t, id)
+	return server.URL + "/stream?id=" + id, json.NewDecoder(r.Body)
+}
+
+func postStream(t *testing.T, url string, subs ...interface{}) *http.Response {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, s := range subs {
+		require.NoError(t, enc.Encode(s))
+	}
+	r, err := http.Post(url, "application/x-ndjson", &body)
+	require.NoError(t, err)
+	r.Body.Close()
+	return r
+}
+
+func closeStream(t *testing.T, url string) *http.Response {
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	require.NoError(t, err)
+	r, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	r.Body.Close()
+	return r
+}
+
+func TestHandleStream(t *testing.T) {
+	n := newTestNode()
+	server := httptest.NewServer(http.HandlerFunc(n.handleStream))
+	t.Cleanup(server.Close)
+	url, dec := openStream(t, server)
+
+	r := postStream(t, url,
+		Submission{Key: 1, Value: db.Value("a"), ClientID: "c", CommandID: 1},
+		Submission{Key: 2, ClientID: "c", CommandID: 2, PubKey: "x", Signature: "1,2"})
+	require.Equal(t, http.StatusNoContent, r.StatusCode)
+	// the invalid submission is acked at once, the others once committed
+	var a Ack
+	require.NoError(t, dec.Decode(&a))
+	require.Equal(t, http.StatusBadRequest, a.Status)
+	require.Equal(t, 2, a.CommandID)
+
+	// submissions are posted again while the acks are pending
+	r = postStream(t, url, Submission{Key: 3, Value: db.Value("b"), ClientID: "c", CommandID: 3})
+	require.Equal(t, http.StatusNoContent, r.StatusCode)
+	require.Equal(t, http.StatusNoContent, closeStream(t, url).StatusCode)
+	require.Equal(t, http.StatusConflict, postStream(t, url, Submission{Key: 4}).StatusCode)
+	go commit(n, 2)
+	acks := make(map[int]Ack)
+	for i := 0; i < 2; i++ {
+		var a Ack
+		require.NoError(t, dec.Decode(&a))
+		acks[a.CommandID] = a
+	}
+	require.Equal(t, Ack{ID: "c.1", CommandID: 1, Status: http.StatusOK, Value: db.Value("a"), Delay: 1000000}, acks[1])
+	require.Equal(t, Ack{ID: "c.3", CommandID: 3, Status: http.StatusOK, Value: db.Value("b"), Delay: 1000000}, acks[3])
+	// the stream ends after the last ack
+	require.Error(t, dec.Decode(&a))
+	require.Equal(t, http.StatusNotFound, closeStream(t, url).StatusCode)
+}
+
+func TestHandleStreamInflight(t *testing.T) {
+	defer func(c config.Config) { config.Configuration = c }(config.Configuration)
+	config.Configuration.MaxBatch = 2
+	n := newTestNode()
+	server := httptest.NewServer(http.HandlerFunc(n.handleStream))
+	t.Cleanup(server.Close)
+	url, dec := openStream(t, server)
+
+	// the third submission is read once an ack is written
+	posted := make(chan *http.Response)
+	go func() {
+		var subs []interface{}
+		for i := 1; i <= 3; i++ {
+			subs = append(subs, Submission{Key: db.Key(i), ClientID: "c", CommandID: i})
+		}
+		posted <- postStream(t, url, subs...)
+	}()
+	require.Eventually(t, func() bool { return len(n.TxChan) == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	require.Len(t, n.TxChan, 2)
+	go commit(n, 3)
+	require.Equal(t, http.StatusNoContent, (<-posted).StatusCode)
+	require.Equal(t, http.StatusNoContent, closeStream(t, url).StatusCode)
+	for i := 0; i < 3; i++ {
+		var a Ack
+		require.NoError(t, dec.Decode(&a))
+		require.Equal(t, http.StatusOK, a.Status)
+	}
+}
+
+func TestHandleStreamInvalid(t *testing.T) {
+	n := newTestNode()
+	server := httptest.NewServer(http.HandlerFunc(n.handleStream))
+	t.Cleanup(server.Close)
+
+	require.Equal(t, http.StatusNotFound, postStream(t, server.URL+"/stream?id=x").StatusCode)
+	url, _ := openStream(t, server)
+	r, err := http.Post(url, "application/x-ndjson", strings.NewReader("{\"key\":\n}"))
+	require.NoError(t, err)
+	r.Body.Close()
+	require.Equal(t, http.StatusBadRequest, r.StatusCode)
+	req, err := http.NewRequest(http.MethodPut, url, nil)
+	require.NoError(t, err)
+	r, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	r.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, r.StatusCode)
+}
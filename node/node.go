@@ -40,6 +40,8 @@ type node struct {
 
 	sync.RWMutex
 	forwards map[string]*message.Transaction
+
+	streams streams
 }
 
 // NewNode creates a new Node object from configuration
@@ -123,14 +125,10 @@ func (n *node) txn() {
 
 // recv receives messages from socket and pass to message channel
 // 用于处理接收到的消息
-// 这段代码是 node 结构中负责接收消息并进行初步处理的方法。它根据消息类型分别处理事务消息和回复消息，同时允许节点进行沉默攻击。
+// 这段代码是 node 结构中负责接收消息并进行初步处理的方法。它根据消息类型分别处理事务消息和回复消息。
 func (n *node) recv() {
 	for {
 		m := n.Recv() //.Recv() 通常是 socket 包中的 Socket 接口的实现之一，用于从节点的网络连接中接收消息。
-		if n.isByz && config.GetConfig().Strategy == "silence" {
-			// perform silence attack
-			continue
-		}
 		switch m := m.(type) {
 		case message.Transaction:
 			m.C = make(chan message.TransactionReply, 1)
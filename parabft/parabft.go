@@ -5,9 +5,11 @@ import (
 	"sync"
 
 	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/byzantine"
 	"github.com/gitferry/bamboo/config"
 	"github.com/gitferry/bamboo/crypto"
 	"github.com/gitferry/bamboo/election"
+	"github.com/gitferry/bamboo/identity"
 	"github.com/gitferry/bamboo/log"
 	"github.com/gitferry/bamboo/message"
 	"github.com/gitferry/bamboo/node"
@@ -15,11 +17,10 @@ import (
 	"github.com/gitferry/bamboo/types"
 )
 
-const FORK = "fork"
-
 type Parabft struct {
 	node.Node
 	election.Election
+	logger          *log.Logger
 	pm              *pacemaker.Pacemaker //Pacemaker 用于同步各个节点的视图和时间，确保节点在同一个时间上进行共识。
 	lastVotedView   types.View           //储存节点上次投票的视图
 	preferredView   types.View
@@ -30,6 +31,9 @@ type Parabft struct {
 	bufferedQCs     map[crypto.Identifier]*blockchain.QC //bufferedQCs 属性：用于缓存待处理的区块证明（QC）。
 	bufferedBlocks  map[types.View]*blockchain.Block
 	mu              sync.Mutex
+
+	// the block voted for per proposer in each uncommitted view
+	votedBlocks map[types.View]map[identity.NodeID]crypto.Identifier
 }
 
 // GetChainStatus implements replica.Safety.
@@ -55,12 +59,14 @@ func NewParabft(
 	forkedBlocks chan *blockchain.Block) *Parabft {
 	hs := new(Parabft)
 	hs.Node = node
+	hs.logger = log.With("node", node.ID())
 	hs.Election = elec
 	hs.pm = pm
 	hs.bc = blockchain.NewBlockchain(config.GetConfig().N())
 	hs.bufferedBlocks = make(map[types.View]*blockchain.Block)
 	hs.bufferedQCs = make(map[crypto.Identifier]*blockchain.QC)
 	hs.highQC = &blockchain.QC{View: 0}
+	hs.votedBlocks = make(map[types.View]map[identity.NodeID]crypto.Identifier)
 	hs.committedBlocks = committedBlocks
 	hs.forkedBlocks = forkedBlocks
 	return hs
@@ -68,7 +74,7 @@ func NewParabft(
 
 // 这个是在replica.go里面调用的
 func (hs *Parabft) ProcessBlock(block *blockchain.Block) error {
-	log.Debugf("[%v] is processing block from %v, view: %v, id: %x", hs.ID(), block.Proposer.Node(), block.View, block.ID)
+	hs.logger.Debugw("is processing block", "proposer", block.Proposer, "view", block.View, "block_id", block.ID)
 
 	hs.bc.AddBlock(block)
 	// process buffered QC
@@ -77,6 +83,10 @@ func (hs *Parabft) ProcessBlock(block *blockchain.Block) error {
 		hs.processCertificate(qc)
 		delete(hs.bufferedQCs, block.ID)
 	}
+	if !hs.votingRule(block) {
+		hs.logger.Warningw("is not going to vote for a conflicting block", "proposer", block.Proposer, "view", block.View, "block_id", block.ID)
+		return nil
+	}
 	vote := blockchain.MakeVote(block.View, hs.ID(), block.ID)
 	//MakeVote生成投票，投票是包含视图号的，可以改为处理投票时候与视图号无关
 	// vote is sent to the next leader
@@ -85,10 +95,17 @@ func (hs *Parabft) ProcessBlock(block *blockchain.Block) error {
 	// voteAggregator := block.Proposer
 	voteAggregator := hs.FindLeaderFor(block.View + 1)
 	if voteAggregator == hs.ID() {
-		log.Debugf("[%v] vote is sent to itself, id: %x", hs.ID(), vote.BlockID)
-		hs.ProcessVote(vote)
+		hs.logger.Debugw("vote is sent to itself", "view", vote.View, "block_id", vote.BlockID)
+		// the votes to itself pass through the strategy like the ones sent
+		votes := []*blockchain.Vote{vote}
+		if byz := hs.strategy(); byz != nil {
+			votes = byz.Vote(vote)
+		}
+		for _, v := range votes {
+			hs.ProcessVote(v)
+		}
 	} else {
-		log.Debugf("[%v] vote is sent to %v, id: %x", hs.ID(), voteAggregator, vote.BlockID)
+		hs.logger.Debugw("vote is sent", "aggregator", voteAggregator, "view", vote.View, "block_id", vote.BlockID)
 		hs.Send(voteAggregator, vote)
 	}
 	b, ok := hs.bufferedBlocks[block.View]
@@ -102,7 +119,7 @@ func (hs *Parabft) ProcessBlock(block *blockchain.Block) error {
 
 // 只有投票的搜集者才处理投票
 func (hs *Parabft) ProcessVote(vote *blockchain.Vote) {
-	log.Debugf("[%v] is processing the vote, block id: %x", hs.ID(), vote.BlockID)
+	hs.logger.Debugw("is processing the vote", "voter", vote.Voter, "view", vote.View, "block_id", vote.BlockID)
 
 	//？？？没看懂这部分干嘛的
 	//因为只有应该搜集本区块投票的节点才执行ProcessVote，判断一下投票是否够了
@@ -111,7 +128,7 @@ func (hs *Parabft) ProcessVote(vote *blockchain.Vote) {
 	// _, qc := hs.bc.AddVote(vote)
 	//投票的时候需要区块ID，可以关注一些区块ID是怎么生成的
 	if !isBuilt {
-		log.Debugf("[%v] not sufficient votes to build a QC, block id: %x", hs.ID(), vote.BlockID)
+		hs.logger.Debugw("not sufficient votes to build a QC", "view", vote.View, "block_id", vote.BlockID)
 		return
 	}
 	//投票数达到了大多数就可以处理QC了
@@ -121,13 +138,13 @@ func (hs *Parabft) ProcessVote(vote *blockchain.Vote) {
 
 }
 func (hs *Parabft) ProcessRemoteTmo(tmo *pacemaker.TMO) {
-	log.Debugf("[%v] is processing tmo from %v", hs.ID(), tmo.NodeID)
+	hs.logger.Debugw("is processing tmo", "from", tmo.NodeID, "view", tmo.View)
 	hs.processCertificate(tmo.HighQC)
 	isBuilt, tc := hs.pm.ProcessRemoteTmo(tmo)
 	if !isBuilt {
 		return
 	}
-	log.Debugf("[%v] a tc is built for view %v", hs.ID(), tc.View)
+	hs.logger.Debugw("a tc is built", "view", tc.View)
 	hs.processTC(tc)
 }
 
@@ -141,10 +158,10 @@ func (hs *Parabft) ProcessLocalTmo(view types.View) {
 	hs.Broadcast(tmo)
 	hs.ProcessRemoteTmo(tmo)
 }
-func (hs *Parabft) MakeProposal(view types.View, payload []*message.Transaction) *blockchain.Block {
+func (hs *Parabft) MakeProposal(view types.View, payload []*message.Transaction, digests []crypto.Identifier) *blockchain.Block {
 	// qc := hs.forkChoice()
 	qc := hs.GetHighQC()
-	block := blockchain.MakeBlock(view, qc, qc.BlockID, payload, hs.ID())
+	block := blockchain.MakeBlock(view, qc, qc.BlockID, payload, digests, hs.ID())
 	//可以尝试一下让前哈希等于自己的ID
 	return block
 }
@@ -168,15 +185,47 @@ func (hs *Parabft) updateHighQC(qc *blockchain.QC) {
 	}
 }
 
+// votingRule allows one vote per proposer per view so that an equivocating
+// leader cannot get both of its proposals certified by honest replicas,
+// a Byzantine replica leaves the decision to its strategy
+func (hs *Parabft) votingRule(block *blockchain.Block) bool {
+	voted, exists := hs.votedBlocks[block.View]
+	if !exists {
+		voted = make(map[identity.NodeID]crypto.Identifier)
+		hs.votedBlocks[block.View] = voted
+	}
+	id, exists := voted[block.Proposer]
+	safe := !exists || id == block.ID
+	if safe {
+		voted[block.Proposer] = block.ID
+	}
+	if byz := hs.strategy(); byz != nil {
+		return byz.ShouldVote(block, safe)
+	}
+	return safe
+}
+
+// strategy returns the Byzantine strategy of the replica, nil if it is honest
+func (hs *Parabft) strategy() byzantine.Byzantine {
+	if !hs.IsByz() {
+		return nil
+	}
+	n, ok := hs.Node.(interface{ Strategy() byzantine.Byzantine })
+	if !ok {
+		return nil
+	}
+	return n.Strategy()
+}
+
 func (hs *Parabft) processCertificate(qc *blockchain.QC) {
-	log.Debugf("[%v] is processing a QC, block id: %x", hs.ID(), qc.BlockID)
+	hs.logger.Debugw("is processing a QC", "view", qc.View, "block_id", qc.BlockID)
 	if qc.View < hs.pm.GetCurView() {
 		return
 	}
 	if qc.Leader != hs.ID() {
 		quorumIsVerified, _ := crypto.VerifyQuorumSignature(qc.AggSig, qc.BlockID, qc.Signers)
 		if quorumIsVerified == false {
-			log.Warningf("[%v] received a quorum with invalid signatures", hs.ID())
+			hs.logger.Warningw("received a quorum with invalid signatures", "leader", qc.Leader, "view", qc.View, "block_id", qc.BlockID)
 			return
 		}
 	}
@@ -194,12 +243,17 @@ func (hs *Parabft) processCertificate(qc *blockchain.QC) {
 	committedBlocks, _, err := hs.bc.CommitBlock(block.ID, hs.pm.GetCurView())
 	//提交这里跟视图号没什么太大的关系
 	if err != nil {
-		log.Errorf("[%v] cannot commit blocks, %w", hs.ID(), err)
+		hs.logger.Errorw("cannot commit blocks", "error", err)
 		return
 	}
 	for _, cBlock := range committedBlocks {
 		hs.committedBlocks <- cBlock
 	}
+	for view := range hs.votedBlocks {
+		if view <= block.View {
+			delete(hs.votedBlocks, view)
+		}
+	}
 	// for _, fBlock := range forkedBlocks {
 	// 	hs.forkedBlocks <- fBlock
 	// }
@@ -0,0 +1,66 @@
+package parabft
+
+import (
+	"testing"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/byzantine"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/node"
+	"github.com/gitferry/bamboo/types"
+	"github.com/stretchr/testify/require"
+)
+
+// strategyNode is a replica following a Byzantine strategy, nil for an honest one
+type strategyNode struct {
+	node.Node
+	byz byzantine.Byzantine
+}
+
+func (n strategyNode) IsByz() bool {
+	return n.byz != nil
+}
+
+func (n strategyNode) Strategy() byzantine.Byzantine {
+	return n.byz
+}
+
+func newVoter(byz byzantine.Byzantine) *Parabft {
+	return &Parabft{
+		Node:        strategyNode{byz: byz},
+		votedBlocks: make(map[types.View]map[identity.NodeID]crypto.Identifier),
+	}
+}
+
+func twins() (*blockchain.Block, *blockchain.Block) {
+	qc := &blockchain.QC{View: 1}
+	block := &blockchain.Block{View: 2, QC: qc, Proposer: "1", ID: crypto.MakeID("block")}
+	twin := &blockchain.Block{View: 2, QC: qc, Proposer: "1", ID: crypto.MakeID("twin")}
+	return block, twin
+}
+
+func TestVotingRule(t *testing.T) {
+	hs := newVoter(nil)
+	block, twin := twins()
+	require.True(t, hs.votingRule(block))
+	require.True(t, hs.votingRule(block))
+	require.False(t, hs.votingRule(twin))
+
+	// the blocks of other proposers are voted for as well
+	other := &blockchain.Block{View: 2, Proposer: "2", ID: crypto.MakeID("other")}
+	require.True(t, hs.votingRule(other))
+}
+
+func TestVotingRuleStrategy(t *testing.T) {
+	// a double voter votes for the twin arriving after its first vote
+	hs := newVoter(byzantine.New(byzantine.DOUBLEVOTE, "1"))
+	block, twin := twins()
+	require.True(t, hs.votingRule(block))
+	require.True(t, hs.votingRule(twin))
+
+	// an honest strategy keeps the rule
+	hs = newVoter(byzantine.New(byzantine.HONEST, "1"))
+	require.True(t, hs.votingRule(block))
+	require.False(t, hs.votingRule(twin))
+}
@@ -0,0 +1,56 @@
+package replica
+
+import (
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/byzantine"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/node"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+// byzNode is the node handed to the protocol, it passes the votes and
+// timeouts the protocol sends through the Byzantine strategy of the replica
+type byzNode struct {
+	node.Node
+	byz    byzantine.Byzantine
+	traces *blockTraces
+}
+
+// Strategy returns the Byzantine strategy the protocol consults for its voting decisions
+func (n *byzNode) Strategy() byzantine.Byzantine {
+	return n.byz
+}
+
+func (n *byzNode) Send(to identity.NodeID, m interface{}) {
+	for _, msg := range n.intercept(m) {
+		if vote, ok := msg.(*blockchain.Vote); ok {
+			n.traces.vote(vote, to)
+		}
+		n.Node.Send(to, msg)
+	}
+}
+
+func (n *byzNode) Broadcast(m interface{}) {
+	for _, msg := range n.intercept(m) {
+		n.Node.Broadcast(msg)
+	}
+}
+
+func (n *byzNode) intercept(m interface{}) []interface{} {
+	switch m := m.(type) {
+	case *blockchain.Vote:
+		votes := n.byz.Vote(m)
+		msgs := make([]interface{}, 0, len(votes))
+		for _, vote := range votes {
+			msgs = append(msgs, vote)
+		}
+		return msgs
+	case *pacemaker.TMO:
+		tmo := n.byz.Timeout(m)
+		if tmo == nil {
+			return nil
+		}
+		return []interface{}{tmo}
+	}
+	return []interface{}{m}
+}
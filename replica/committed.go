@@ -0,0 +1,53 @@
+package replica
+
+import (
+	"encoding/hex"
+	"sync"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/message"
+)
+
+// committedLog records the committed chain of the replica by height so that
+// the chains of all replicas can be cross-checked
+type committedLog struct {
+	mu     sync.RWMutex
+	blocks []message.CommittedBlock
+}
+
+func (l *committedLog) append(block *blockchain.Block) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.blocks = append(l.blocks, message.CommittedBlock{
+		Height: len(l.blocks),
+		View:   block.View,
+		ID:     hex.EncodeToString(block.ID[:]),
+	})
+}
+
+// height returns the number of committed blocks
+func (l *committedLog) height() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.blocks)
+}
+
+// from returns the committed blocks starting at the height
+func (l *committedLog) from(height int) []message.CommittedBlock {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if height < 0 {
+		height = 0
+	}
+	if height > len(l.blocks) {
+		height = len(l.blocks)
+	}
+	blocks := make([]message.CommittedBlock, len(l.blocks)-height)
+	copy(blocks, l.blocks[height:])
+	return blocks
+}
+
+// handleCommittedQuery replies with the committed chain from the queried height
+func (r *Replica) handleCommittedQuery(m message.CommittedQuery) {
+	m.Reply(message.CommittedReply{Blocks: r.committed.from(m.From)})
+}
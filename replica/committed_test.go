@@ -0,0 +1,37 @@
+package replica
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommittedLog(t *testing.T) {
+	r := newTestReplica("2")
+	var ids []string
+	for view := 1; view <= 3; view++ {
+		b := blockchain.MakeBlock(types.View(view), &blockchain.QC{BlockID: crypto.MakeID(view)}, crypto.MakeID(view), nil, nil, "1")
+		r.committed.append(b)
+		ids = append(ids, hex.EncodeToString(b.ID[:]))
+	}
+	require.Equal(t, 3, r.committed.height())
+
+	query := func(from int) []message.CommittedBlock {
+		q := message.CommittedQuery{From: from, C: make(chan message.CommittedReply, 1)}
+		r.handleCommittedQuery(q)
+		return (<-q.C).Blocks
+	}
+	blocks := query(1)
+	require.Len(t, blocks, 2)
+	for i, b := range blocks {
+		require.Equal(t, i+1, b.Height)
+		require.Equal(t, ids[i+1], b.ID)
+	}
+	require.Len(t, query(-1), 3)
+	require.Empty(t, query(5))
+}
@@ -0,0 +1,122 @@
+package replica
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/types"
+)
+
+// evidenceWindow is the number of views the detector remembers
+const evidenceWindow = 100
+
+// evidencePool keeps the verified evidence of misbehaviour by offender,
+// replicas with evidence against them are excluded from the protocol
+type evidencePool struct {
+	mu       sync.RWMutex
+	evidence map[identity.NodeID][]*blockchain.Evidence
+}
+
+func newEvidencePool() *evidencePool {
+	return &evidencePool{
+		evidence: make(map[identity.NodeID][]*blockchain.Evidence),
+	}
+}
+
+// add stores the evidence and returns false if the misbehaviour is already known
+func (p *evidencePool) add(ev *blockchain.Evidence) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.evidence[ev.Offender] {
+		if e.Kind == ev.Kind && e.View == ev.View {
+			return false
+		}
+	}
+	p.evidence[ev.Offender] = append(p.evidence[ev.Offender], ev)
+	return true
+}
+
+func (p *evidencePool) isConvicted(id identity.NodeID) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.evidence[id]) > 0
+}
+
+// evidenceInfo is the json view of an evidence
+type evidenceInfo struct {
+	Kind   string     `json:"kind"`
+	View   types.View `json:"view"`
+	Blocks [2]string  `json:"blocks"`
+}
+
+func (p *evidencePool) marshal() ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	infos := make(map[identity.NodeID][]evidenceInfo, len(p.evidence))
+	for offender, evidence := range p.evidence {
+		for _, ev := range evidence {
+			infos[offender] = append(infos[offender], evidenceInfo{
+				Kind: ev.Kind,
+				View: ev.View,
+				Blocks: [2]string{
+					hex.EncodeToString(ev.Headers[0].ID[:]),
+					hex.EncodeToString(ev.Headers[1].ID[:]),
+				},
+			})
+		}
+	}
+	return json.Marshal(infos)
+}
+
+// processEvidence keeps and gossips the evidence found by the local detector
+func (r *Replica) processEvidence(ev *blockchain.Evidence) {
+	if ev == nil || !r.evidence.add(ev) {
+		return
+	}
+	r.logger.Warningw("detected misbehaviour", "evidence", ev, "offender", ev.Offender, "view", ev.View)
+	r.Broadcast(*ev)
+}
+
+// HandleEvidence keeps the evidence gossiped by other replicas once verified
+func (r *Replica) HandleEvidence(ev blockchain.Evidence) {
+	if err := ev.Verify(); err != nil {
+		r.logger.Warningw("received invalid evidence from a peer", "error", err)
+		return
+	}
+	if r.evidence.add(&ev) {
+		r.logger.Warningw("received evidence", "evidence", &ev, "offender", ev.Offender, "view", ev.View)
+	}
+}
+
+// requestHeaders asks voters for the blocks they voted for that never arrived here,
+// the proposer may have sent a different block to this replica
+func (r *Replica) requestHeaders(view types.View) {
+	for id, vote := range r.detector.Missing(view) {
+		r.Send(vote.Voter, blockchain.HeaderRequest{
+			View:      vote.View,
+			BlockID:   id,
+			Requester: r.ID(),
+		})
+	}
+}
+
+func (r *Replica) HandleHeaderRequest(req blockchain.HeaderRequest) {
+	r.eventChan <- req
+}
+
+func (r *Replica) HandleHeader(h blockchain.Header) {
+	r.eventChan <- h
+}
+
+// handleEvidenceQuery replies with the evidence collected by the replica
+func (r *Replica) handleEvidenceQuery(m message.EvidenceQuery) {
+	evidence, err := r.evidence.marshal()
+	if err != nil {
+		r.logger.Errorw("cannot encode evidence", "error", err)
+	}
+	m.Reply(message.EvidenceReply{Evidence: evidence})
+}
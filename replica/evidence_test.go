@@ -0,0 +1,52 @@
+package replica
+
+import (
+	"testing"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+func equivocation() blockchain.Evidence {
+	qc := &blockchain.QC{View: 1, BlockID: crypto.MakeID("parent")}
+	txns := []*message.Transaction{{ID: "1.1"}, {ID: "1.2"}}
+	block := blockchain.MakeBlock(2, qc, qc.BlockID, txns, nil, "1")
+	twin := blockchain.MakeBlock(2, qc, qc.BlockID, []*message.Transaction{txns[1], txns[0]}, nil, "1")
+	return blockchain.Evidence{
+		Kind:     blockchain.EquivocatingProposal,
+		Offender: "1",
+		View:     2,
+		Headers:  []*blockchain.Header{block.Header(), twin.Header()},
+	}
+}
+
+func TestHandleEvidence(t *testing.T) {
+	r := newTestReplica("2")
+
+	// evidence framing another replica is dropped
+	forged := equivocation()
+	forged.Offender = "3"
+	r.HandleEvidence(forged)
+	require.False(t, r.evidence.isConvicted("3"))
+
+	// so is evidence with a block the offender did not sign
+	forged = equivocation()
+	h := *forged.Headers[1]
+	h.Sig = nil
+	forged.Headers[1] = &h
+	r.HandleEvidence(forged)
+	require.False(t, r.evidence.isConvicted("1"))
+
+	r.HandleEvidence(equivocation())
+	require.True(t, r.evidence.isConvicted("1"))
+	require.False(t, r.evidence.isConvicted("2"))
+
+	// the same misbehaviour is kept once
+	ev := equivocation()
+	require.False(t, r.evidence.add(&ev))
+	info, err := r.evidence.marshal()
+	require.NoError(t, err)
+	require.Contains(t, string(info), `"kind":"proposal"`)
+}
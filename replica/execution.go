@@ -0,0 +1,81 @@
+package replica
+
+import (
+	"sync"
+
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/message"
+)
+
+// executedWindow is the number of recently executed transactions remembered
+const executedWindow = 1 << 20
+
+// executedSet remembers the ids of the recently executed anonymous transactions, a transaction
+// submitted to several replicas may be committed more than once but is executed once. The
+// transactions of clients are deduplicated by the sessions of the database
+type executedSet struct {
+	ids   map[string]bool
+	order []string // ring of the remembered ids
+	next  int
+}
+
+func newExecutedSet(size int) *executedSet {
+	return &executedSet{
+		ids:   make(map[string]bool, size),
+		order: make([]string, size),
+	}
+}
+
+// add returns false if the id has been added before
+func (s *executedSet) add(id string) bool {
+	if s.ids[id] {
+		return false
+	}
+	delete(s.ids, s.order[s.next])
+	s.order[s.next] = id
+	s.next = (s.next + 1) % len(s.order)
+	s.ids[id] = true
+	return true
+}
+
+// waiting holds the transactions whose clients wait at this replica by id, the clients are
+// answered when the first copy of their transaction commits, in any replica's block
+type waiting struct {
+	mu   sync.Mutex
+	txns map[string]*message.Transaction
+}
+
+func newWaiting() *waiting {
+	return &waiting{txns: make(map[string]*message.Transaction)}
+}
+
+// add returns the transaction waiting for the same id before, a retry of the client replaces it
+func (w *waiting) add(txn *message.Transaction) *message.Transaction {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	old := w.txns[txn.ID]
+	w.txns[txn.ID] = txn
+	return old
+}
+
+// remove returns the waiting transaction of the id, nil if there is none
+func (w *waiting) remove(id string) *message.Transaction {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	txn, ok := w.txns[id]
+	if !ok {
+		return nil
+	}
+	delete(w.txns, id)
+	return txn
+}
+
+// execute applies the committed transaction to the database, a read returns the
+// current value and a write the previous one. A transaction executed before returns
+// its first reply
+func (r *Replica) execute(txn *message.Transaction) (db.Value, error) {
+	if txn.Command.ClientID == "" && !r.executed.add(txn.ID) {
+		return nil, nil
+	}
+	return r.db.Execute(txn.Command)
+}
@@ -0,0 +1,108 @@
+package replica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/worker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvictAfterRetry(t *testing.T) {
+	r := newTestReplica("2")
+	cmd := db.Command{Key: 1, Value: db.Value("v"), ClientID: "c", CommandID: 1}
+
+	// the first submission is pooled and waited for, the retry replaces it as the waiter
+	pooled := &message.Transaction{ID: "c.1", Command: cmd, C: make(chan message.TransactionReply, 1)}
+	r.wait(pooled)
+	first := pooled.C
+	retry := &message.Transaction{ID: "c.1", Command: cmd, C: make(chan message.TransactionReply, 1)}
+	r.wait(retry)
+	second := retry.C
+	require.Equal(t, mempool.ErrDuplicate, (<-first).Err)
+	require.Nil(t, pooled.C)
+
+	done := make(chan struct{})
+	go func() {
+		r.evict([]*message.Transaction{pooled})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("evicting the pooled copy blocked")
+	}
+	require.Equal(t, mempool.ErrEvicted, (<-second).Err)
+	require.Nil(t, r.waiting.remove("c.1"))
+
+	// an eviction without a waiting client answers nobody
+	r.evict([]*message.Transaction{pooled})
+}
+
+func TestCommittedBlocksWaitForBatches(t *testing.T) {
+	c := config.Configuration
+	defer func() { config.Configuration = c }()
+	config.Configuration.Workers = true
+
+	r := newTestReplica("2")
+	r.worker = worker.New(r.Node, r.pd)
+	r.committedBlocks = make(chan *blockchain.Block, 2)
+	r.forkedBlocks = make(chan *blockchain.Block)
+	r.available = make(chan struct{}, 1)
+	go r.ListenCommittedBlocks()
+
+	missing := worker.MakeBatch("1", []*message.Transaction{put(1)})
+	held := worker.MakeBatch("1", []*message.Transaction{put(2)})
+	r.worker.HandleBatch(*held)
+	qc := &blockchain.QC{View: 1, BlockID: crypto.MakeID("parent")}
+	first := blockchain.MakeBlock(2, qc, qc.BlockID, nil, []crypto.Identifier{missing.Digest}, "1")
+	second := blockchain.MakeBlock(3, &blockchain.QC{View: 2, BlockID: first.ID}, first.ID, nil, []crypto.Identifier{held.Digest}, "1")
+	r.committedBlocks <- first
+	r.committedBlocks <- second
+
+	// the second block waits behind the first one, whose batch is requested
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, 0, r.committed.height())
+	r.worker.HandleBatch(*missing)
+	require.Eventually(t, func() bool { return r.committed.height() == 2 }, time.Second, 5*time.Millisecond)
+	blocks := r.committed.from(0)
+	require.Equal(t, first.View, blocks[0].View)
+	require.Equal(t, second.View, blocks[1].View)
+}
+
+func TestExecute(t *testing.T) {
+	r := newTestReplica("2")
+	write := func(id string, cid int, v string) *message.Transaction {
+		return &message.Transaction{ID: id, Command: db.Command{Key: 1, Value: db.Value(v), ClientID: "c", CommandID: cid}}
+	}
+
+	// a write returns the previous value and a read the current one
+	v, err := r.execute(write("c.1", 1, "a"))
+	require.NoError(t, err)
+	require.Nil(t, v)
+	v, err = r.execute(write("c.2", 2, "b"))
+	require.NoError(t, err)
+	require.Equal(t, db.Value("a"), v)
+	v, err = r.execute(&message.Transaction{ID: "c.3", Command: db.Command{Key: 1, ClientID: "c", CommandID: 3}})
+	require.NoError(t, err)
+	require.Equal(t, db.Value("b"), v)
+
+	// an anonymous transaction committed twice is executed once
+	anonymous := &message.Transaction{ID: "1.1", Command: db.Command{Key: 1, Value: db.Value("x")}}
+	v, err = r.execute(anonymous)
+	require.NoError(t, err)
+	require.Equal(t, db.Value("b"), v)
+	_, err = r.execute(write("c.4", 4, "y"))
+	require.NoError(t, err)
+	_, err = r.execute(anonymous)
+	require.NoError(t, err)
+	v, err = r.execute(&message.Transaction{ID: "1.2", Command: db.Command{Key: 1}})
+	require.NoError(t, err)
+	require.Equal(t, db.Value("y"), v)
+}
@@ -0,0 +1,87 @@
+package replica
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/node"
+)
+
+// gossip relays the transactions received from clients to the other replicas in batches,
+// a batch is sent when it is full or when its first transaction has waited long enough
+type gossip struct {
+	node  node.Node
+	size  int
+	delay time.Duration
+	sent  func(n int)
+
+	mu    sync.Mutex
+	txns  []message.Transaction
+	timer *time.Timer
+}
+
+// newGossip returns nil if gossip is disabled, the methods of a nil gossip do nothing
+func newGossip(n node.Node, sent func(n int)) *gossip {
+	if !config.GetConfig().Gossip {
+		return nil
+	}
+	size := config.GetConfig().GossipBatch
+	if size <= 0 {
+		size = 1
+	}
+	return &gossip{
+		node:  n,
+		size:  size,
+		delay: time.Duration(config.GetConfig().GossipDelay) * time.Millisecond,
+		sent:  sent,
+	}
+}
+
+func (g *gossip) add(txn *message.Transaction) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	relayed := *txn
+	relayed.C = nil
+	g.txns = append(g.txns, relayed)
+	if len(g.txns) < g.size {
+		if len(g.txns) == 1 {
+			g.timer = time.AfterFunc(g.delay, g.flush)
+		}
+		g.mu.Unlock()
+		return
+	}
+	txns := g.take()
+	g.mu.Unlock()
+	g.relay(txns)
+}
+
+func (g *gossip) flush() {
+	g.mu.Lock()
+	txns := g.take()
+	g.mu.Unlock()
+	g.relay(txns)
+}
+
+// take empties the pending batch, the lock is held
+func (g *gossip) take() []message.Transaction {
+	txns := g.txns
+	g.txns = nil
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	return txns
+}
+
+func (g *gossip) relay(txns []message.Transaction) {
+	if len(txns) == 0 {
+		return
+	}
+	g.node.Broadcast(mempool.Batch{Sender: g.node.ID(), Txns: txns})
+	g.sent(len(txns))
+}
@@ -0,0 +1,135 @@
+package replica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/stretchr/testify/require"
+)
+
+// withGossip enables gossip with the batch size and delay until the test ends
+func withGossip(t *testing.T, size, delay int) {
+	c := config.Configuration
+	t.Cleanup(func() { config.Configuration = c })
+	config.Configuration.Gossip = true
+	config.Configuration.GossipBatch = size
+	config.Configuration.GossipDelay = delay
+}
+
+func TestGossipBatching(t *testing.T) {
+	withGossip(t, 3, 60000)
+	n := &broadcastNode{id: "1"}
+	var relayed int
+	g := newGossip(n, func(txs int) { relayed += txs })
+
+	g.add(put(1))
+	g.add(put(2))
+	require.Empty(t, n.batches())
+	g.add(put(3))
+	batches := n.batches()
+	require.Len(t, batches, 1)
+	require.Equal(t, identity.NodeID("1"), batches[0].Sender)
+	require.Len(t, batches[0].Txns, 3)
+	for _, txn := range batches[0].Txns {
+		// the client waits at the receiving replica only
+		require.Nil(t, txn.C)
+	}
+	require.Equal(t, 3, relayed)
+}
+
+func TestGossipFlush(t *testing.T) {
+	withGossip(t, 100, 10)
+	n := &broadcastNode{id: "1"}
+	g := newGossip(n, func(int) {})
+
+	g.add(put(1))
+	g.add(put(2))
+	require.Eventually(t, func() bool { return len(n.batches()) == 1 }, time.Second, 5*time.Millisecond)
+	require.Len(t, n.batches()[0].Txns, 2)
+
+	// the timer starts again with the next batch
+	g.add(put(3))
+	require.Eventually(t, func() bool { return len(n.batches()) == 2 }, time.Second, 5*time.Millisecond)
+	require.Len(t, n.batches()[1].Txns, 1)
+}
+
+func TestGossipDisabled(t *testing.T) {
+	c := config.Configuration
+	defer func() { config.Configuration = c }()
+	config.Configuration.Gossip = false
+	g := newGossip(&broadcastNode{id: "1"}, func(int) {})
+	require.Nil(t, g)
+	g.add(put(1))
+}
+
+func TestHandleRelayedBatch(t *testing.T) {
+	r := newTestReplica("2")
+	pending := put(1)
+	_, err := r.pd.AddTxn(pending)
+	require.NoError(t, err)
+
+	r.handleBatch(mempool.Batch{Sender: "1", Txns: []message.Transaction{*put(1), *put(2), *put(3)}})
+	// the transaction already pending is skipped
+	require.Equal(t, 3, r.pd.Size())
+	require.True(t, <-r.start)
+
+	// a relayed copy of a committed transaction is not proposed again
+	r.pd.Committed([]*message.Transaction{put(4)})
+	r.handleBatch(mempool.Batch{Sender: "1", Txns: []message.Transaction{*put(4)}})
+	require.Equal(t, 3, r.pd.Size())
+}
+
+func TestHandleRelayedBatchSigned(t *testing.T) {
+	c := config.Configuration
+	defer func() { config.Configuration = c }()
+	config.Configuration.SignedTxs = true
+
+	r := newTestReplica("2")
+	r.handleBatch(mempool.Batch{Sender: "1", Txns: []message.Transaction{*put(1)}})
+	require.Equal(t, 0, r.pd.Size())
+}
+
+// Parallel proposers each propose the relayed copies in their mempools, so a transaction
+// may be included in several blocks. It is executed once and answered once.
+func TestDuplicateInclusion(t *testing.T) {
+	r := newTestReplica("2")
+	txn := put(1)
+	reply := txn.C
+	r.wait(txn)
+	// the copy relayed to this replica is still pending
+	_, err := r.pd.AddTxn(put(1))
+	require.NoError(t, err)
+
+	qc := &blockchain.QC{View: 1, BlockID: crypto.MakeID("parent")}
+	for _, proposer := range []identity.NodeID{"1", "3"} {
+		included := put(1)
+		included.C = nil
+		r.processCommittedBlock(blockchain.MakeBlock(2, qc, qc.BlockID, []*message.Transaction{included}, nil, proposer))
+	}
+	require.Equal(t, 0, r.pd.Size())
+	first := <-reply
+	require.NoError(t, first.Err)
+	require.Nil(t, first.Value)
+	select {
+	case <-reply:
+		t.Fatal("the client is answered twice")
+	default:
+	}
+
+	// the write is applied and its session keeps the reply of the first execution, a second
+	// execution would have replied the value it wrote
+	value, err := r.db.Execute(db.Command{Key: 1, ClientID: "d", CommandID: 1})
+	require.NoError(t, err)
+	require.Equal(t, db.Value("v"), value)
+	value, executed, err := r.db.Lookup(put(1).Command)
+	require.True(t, executed)
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
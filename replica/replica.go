@@ -2,7 +2,6 @@ package replica
 
 import (
 	"encoding/gob"
-	"fmt"
 	"time"
 
 	// fhs "github.com/gitferry/bamboo/fasthostuff"
@@ -14,7 +13,9 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/byzantine"
 	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/db"
 	"github.com/gitferry/bamboo/election"
 
 	// "github.com/gitferry/bamboo/hotstuff"
@@ -28,6 +29,7 @@ import (
 	// "github.com/gitferry/bamboo/streamlet"
 
 	"github.com/gitferry/bamboo/types"
+	"github.com/gitferry/bamboo/worker"
 	//"github.com/tealeg/xlsx"
 )
 
@@ -39,70 +41,97 @@ type Replica struct {
 	pm              *pacemaker.Pacemaker
 	start           chan bool // signal to start the node
 	isStarted       atomic.Bool
-	isByz           bool
+	byz             byzantine.Byzantine
+	detector        *blockchain.Detector
+	evidence        *evidencePool
+	committed       *committedLog
+	stats           *stats
+	logger          *log.Logger
+	traces          *blockTraces
+	db              db.Database
+	executed        *executedSet
+	waiting         *waiting
+	gossip          *gossip
+	worker          *worker.Worker
 	timer           *time.Timer // timeout for each view
 	committedBlocks chan *blockchain.Block
 	forkedBlocks    chan *blockchain.Block
+	available       chan struct{} // the batches of a committed block have arrived
 	eventChan       chan interface{}
 
 	/* for monitoring node statistics */
-	thrus                string
-	lastViewTime         time.Time
-	startTime            time.Time
-	tmpTime              time.Time
-	voteStart            time.Time
-	totalCreateDuration  time.Duration
-	totalProcessDuration time.Duration
-	totalProposeDuration time.Duration
-	totalDelay           time.Duration
-	totalRoundTime       time.Duration
-	totalVoteTime        time.Duration
-	totalBlockSize       int
-	receivedNo           int
-	roundNo              int
-	voteNo               int
-	totalCommittedTx     int
-	latencyNo            int
-	proposedNo           int
-	processedNo          int
-	committedNo          int
+	lastViewTime time.Time
+	startTime    time.Time
 }
 
 // NewReplica creates a new replica instance
 func NewReplica(id identity.NodeID, alg string, isByz bool) *Replica {
 	r := new(Replica)
 	r.Node = node.NewNode(id, isByz)
+	r.logger = log.With("node", id)
+	r.byz = byzantine.New(config.GetConfig().StrategyOf(id), id)
+	r.detector = blockchain.NewDetector(evidenceWindow)
+	r.evidence = newEvidencePool()
+	r.committed = new(committedLog)
+	r.stats = newStats()
+	r.SetMeter(r.stats.sent)
+	r.traces = newBlockTraces(id)
+	r.db = db.NewDatabase()
+	r.executed = newExecutedSet(executedWindow)
+	r.waiting = newWaiting()
+	r.gossip = newGossip(r.Node, r.stats.relay)
 	if isByz {
-		log.Infof("[%v] is Byzantine", r.ID())
+		r.logger.Infow("is Byzantine", "strategy", config.GetConfig().StrategyOf(id))
 	}
 	if config.GetConfig().Master == "0" {
 		r.Election = election.NewRotation(config.GetConfig().N())
 	} else {
 		r.Election = election.NewStatic(config.GetConfig().Master)
 	}
-	r.isByz = isByz
 	r.pd = mempool.NewProducer()
+	r.worker = worker.New(r.Node, r.pd)
 	r.pm = pacemaker.NewPacemaker(config.GetConfig().N())
+	r.registerGauges()
 	r.start = make(chan bool)
 	r.eventChan = make(chan interface{})
 	r.committedBlocks = make(chan *blockchain.Block, 100)
 	r.forkedBlocks = make(chan *blockchain.Block, 100)
+	r.available = make(chan struct{}, 1)
 	r.Register(blockchain.Block{}, r.HandleBlock)
 	r.Register(blockchain.Vote{}, r.HandleVote)
 	r.Register(pacemaker.TMO{}, r.HandleTmo)
 	r.Register(message.Transaction{}, r.handleTxn)
+	r.Register(mempool.Batch{}, r.handleBatch)
 	r.Register(message.Query{}, r.handleQuery)
+	r.Register(message.MetricsQuery{}, r.handleMetricsQuery)
+	r.Register(message.EvidenceQuery{}, r.handleEvidenceQuery)
+	r.Register(message.CommittedQuery{}, r.handleCommittedQuery)
+	r.Register(blockchain.Evidence{}, r.HandleEvidence)
+	r.Register(blockchain.HeaderRequest{}, r.HandleHeaderRequest)
+	r.Register(blockchain.Header{}, r.HandleHeader)
+	if r.worker != nil {
+		r.Register(worker.Batch{}, r.worker.HandleBatch)
+		r.Register(worker.BatchRequest{}, r.worker.HandleBatchRequest)
+	}
 	gob.Register(blockchain.Block{})
 	gob.Register(blockchain.Vote{})
+	gob.Register(blockchain.Evidence{})
+	gob.Register(blockchain.HeaderRequest{})
+	gob.Register(blockchain.Header{})
 	gob.Register(pacemaker.TC{})
 	gob.Register(pacemaker.TMO{})
+	gob.Register(mempool.Batch{})
+	gob.Register(worker.Batch{})
+	gob.Register(worker.BatchRequest{})
 
+	// the protocol sends through the Byzantine strategy
+	n := &byzNode{Node: r.Node, byz: r.byz, traces: r.traces}
 	// Is there a better way to reduce the number of parameters?
 	switch alg {
 	case "parabft":
-		r.Safety = parabft.NewParabft(r.Node, r.pm, r.Election, r.committedBlocks, r.forkedBlocks)
+		r.Safety = parabft.NewParabft(n, r.pm, r.Election, r.committedBlocks, r.forkedBlocks)
 	default:
-		r.Safety = parabft.NewParabft(r.Node, r.pm, r.Election, r.committedBlocks, r.forkedBlocks)
+		r.Safety = parabft.NewParabft(n, r.pm, r.Election, r.committedBlocks, r.forkedBlocks)
 	}
 	return r
 }
@@ -110,87 +139,219 @@ func NewReplica(id identity.NodeID, alg string, isByz bool) *Replica {
 /* Message Handlers */
 
 func (r *Replica) HandleBlock(block blockchain.Block) {
-	r.receivedNo++
+	if !r.byz.Forward(block) {
+		return
+	}
+	if r.evidence.isConvicted(block.Proposer) {
+		r.logger.Debugw("dropped a block from a convicted replica", "proposer", block.Proposer, "view", block.View, "block_id", block.ID)
+		return
+	}
+	if err := mempool.CheckBytes(block.Payload); err != nil {
+		r.logger.Warningw("dropped an oversized block", "proposer", block.Proposer, "view", block.View, "block_id", block.ID, "error", err)
+		return
+	}
+	if err := mempool.CheckSignatures(block.Payload); err != nil {
+		r.logger.Warningw("dropped a block with a forged transaction", "proposer", block.Proposer, "view", block.View, "block_id", block.ID, "error", err)
+		return
+	}
 	r.startSignal()
-	log.Debugf("[%v] received a block from %v, view is %v, id: %x, prevID: %x", r.ID(), block.Proposer, block.View, block.ID, block.PrevID)
+	r.logger.Debugw("received a block", "proposer", block.Proposer, "view", block.View, "block_id", block.ID, "prev_id", block.PrevID)
 	r.eventChan <- block
 }
 
 func (r *Replica) HandleVote(vote blockchain.Vote) {
+	if !r.byz.Forward(vote) {
+		return
+	}
 	if vote.View < r.pm.GetCurView() {
 		return
 	}
+	if r.evidence.isConvicted(vote.Voter) {
+		r.logger.Debugw("dropped a vote from a convicted replica", "voter", vote.Voter, "view", vote.View, "block_id", vote.BlockID)
+		return
+	}
 	r.startSignal()
-	log.Debugf("[%v] received a vote frm %v, blockID is %x", r.ID(), vote.Voter, vote.BlockID)
+	r.logger.Debugw("received a vote", "voter", vote.Voter, "view", vote.View, "block_id", vote.BlockID)
 	r.eventChan <- vote
 }
 
 func (r *Replica) HandleTmo(tmo pacemaker.TMO) {
+	if !r.byz.Forward(tmo) {
+		return
+	}
 	if tmo.View < r.pm.GetCurView() {
 		return
 	}
-	log.Debugf("[%v] received a timeout from %v for view %v", r.ID(), tmo.NodeID, tmo.View)
+	r.logger.Debugw("received a timeout", "from", tmo.NodeID, "view", tmo.View)
 	r.eventChan <- tmo
 }
 
-// handleQuery replies a query with the statistics of the node
-func (r *Replica) handleQuery(m message.Query) {
-	//realAveProposeTime := float64(r.totalProposeDuration.Milliseconds()) / float64(r.processedNo)
-	//aveProcessTime := float64(r.totalProcessDuration.Milliseconds()) / float64(r.processedNo)
-	//aveVoteProcessTime := float64(r.totalVoteTime.Milliseconds()) / float64(r.roundNo)
-	//aveBlockSize := float64(r.totalBlockSize) / float64(r.proposedNo)
-	requestRate := float64(r.pd.TotalReceivedTxNo()) / time.Now().Sub(r.startTime).Seconds()
-	//committedRate := float64(r.committedNo) / time.Now().Sub(r.startTime).Seconds()
-	//aveRoundTime := float64(r.totalRoundTime.Milliseconds()) / float64(r.roundNo)
-	//aveProposeTime := aveRoundTime - aveProcessTime - aveVoteProcessTime
-	latency := float64(r.totalDelay.Milliseconds()) / float64(r.latencyNo)
-	r.thrus += fmt.Sprintf("Time: %.0f s. tp: %6.0f   txs/s,Request rate is %6.0f   txs/slatency is  %6.4f  ms\n", time.Now().Sub(r.startTime).Seconds(), float64(r.totalCommittedTx)/time.Now().Sub(r.tmpTime).Seconds(), requestRate, latency)
-	r.totalCommittedTx = 0
-	r.tmpTime = time.Now()
-	status := fmt.Sprintf("Latency: %v\n%s", latency, r.thrus)
-	//status := fmt.Sprintf("chain status is: %s\nCommitted rate is %v.\nAve. block size is %v.\nAve. trans. delay is %v ms.\nAve. creation time is %f ms.\nAve. processing time is %v ms.\nAve. vote time is %v ms.\nRequest rate is %f txs/s.\nAve. round time is %f ms.\nLatency is %f ms.\nThroughput is %f txs/s.\n", r.Safety.GetChainStatus(), committedRate, aveBlockSize, aveTransDelay, aveCreateDuration, aveProcessTime, aveVoteProcessTime, requestRate, aveRoundTime, latency, throughput)
-	//status := fmt.Sprintf("Ave. actual proposing time is %v ms.\nAve. proposing time is %v ms.\nAve. processing time is %v ms.\nAve. vote time is %v ms.\nAve. block size is %v.\nAve. round time is %v ms.\nLatency is %v ms.\n", realAveProposeTime, aveProposeTime, aveProcessTime, aveVoteProcessTime, aveBlockSize, aveRoundTime, latency)
-	m.Reply(message.QueryReply{Info: status})
+func (r *Replica) handleTxn(m message.Transaction) {
+	var evicted []*message.Transaction
+	err := r.verify(&m)
+	if err == nil {
+		// a retry of an executed transaction gets the first reply from the session of its client
+		if value, executed, err := r.db.Lookup(m.Command); executed {
+			r.logger.Debugw("answered a retried transaction", "tx", m.ID)
+			r.reply(&m, value, err)
+			return
+		}
+		evicted, err = r.pd.AddTxn(&m)
+		r.evict(evicted)
+	}
+	if err == mempool.ErrDuplicate || err == mempool.ErrCommitted {
+		// a retry of a pending transaction waits for its commitment
+		if m.C != nil {
+			r.wait(&m)
+		}
+		return
+	}
+	if err != nil {
+		r.logger.Debugw("rejected a transaction", "tx", m.ID, "error", err)
+		if m.C != nil {
+			m.Reply(message.TransactionReply{Command: m.Command, Err: err})
+		}
+		return
+	}
+	if m.C != nil {
+		r.wait(&m)
+	}
+	r.gossip.add(&m)
+	r.kickOff()
 }
 
-func (r *Replica) handleTxn(m message.Transaction) {
-	r.pd.AddTxn(&m)
+// wait registers the client waiting for the transaction, a client waiting for the same id
+// before is answered with a duplicate. The client is answered at once if the transaction
+// has been executed meanwhile
+func (r *Replica) wait(txn *message.Transaction) {
+	if old := r.waiting.add(txn); old != nil && old.C != nil {
+		old.Reply(message.TransactionReply{Command: old.Command, Err: mempool.ErrDuplicate})
+		old.C = nil
+	}
+	if value, executed, err := r.db.Lookup(txn.Command); executed {
+		if local := r.waiting.remove(txn.ID); local != nil {
+			r.reply(local, value, err)
+		}
+	}
+}
+
+// handleBatch adds the transactions relayed by another replica, the ones already known are skipped
+func (r *Replica) handleBatch(batch mempool.Batch) {
+	added := 0
+	for i := range batch.Txns {
+		txn := batch.Txns[i]
+		if err := r.verify(&txn); err != nil {
+			r.logger.Warningw("dropped a relayed transaction", "sender", batch.Sender, "tx", txn.ID, "error", err)
+			continue
+		}
+		evicted, err := r.pd.AddTxn(&txn)
+		r.evict(evicted)
+		if err == nil {
+			added++
+		}
+	}
+	r.logger.Debugw("received a batch of transactions", "sender", batch.Sender, "transactions", len(batch.Txns), "added", added)
+	if added > 0 {
+		r.kickOff()
+	}
+}
+
+// verify checks the client signature of a transaction if signed transactions are required
+func (r *Replica) verify(txn *message.Transaction) error {
+	if !config.GetConfig().SignedTxs {
+		return nil
+	}
+	return txn.Verify()
+}
+
+// evict answers the clients waiting for the transactions evicted from the memory pool
+func (r *Replica) evict(evicted []*message.Transaction) {
+	for _, txn := range evicted {
+		// the client waits on its own copy, the pooled one may be a retry without a channel
+		if local := r.waiting.remove(txn.ID); local != nil && local.C != nil {
+			local.Reply(message.TransactionReply{Command: local.Command, Err: mempool.ErrEvicted})
+			local.C = nil
+		}
+	}
+}
+
+// kickOff starts the replica on its first transaction, the first leader starts the protocol
+func (r *Replica) kickOff() {
 	r.startSignal()
-	// the first leader kicks off the protocol
 	if r.pm.GetCurView() == 0 && r.IsLeader(r.ID(), 1) {
-		log.Debugf("[%v] is going to kick off the protocol", r.ID())
+		r.logger.Debugw("is going to kick off the protocol")
 		r.pm.AdvanceView(0)
 	}
 }
 
 /* Processors */
 
-func (r *Replica) processCommittedBlock(block *blockchain.Block) {
-	if block.Proposer == r.ID() {
-		for _, txn := range block.Payload {
-			// only record the delay of transactions from the local memory pool
-			delay := time.Now().Sub(txn.Timestamp)
-			r.totalDelay += delay
-			r.latencyNo++
+// processCommittedBlock executes the committed block, it returns false if some of its
+// batches are missing, the block is processed again once they have arrived
+func (r *Replica) processCommittedBlock(block *blockchain.Block) bool {
+	var latencies []time.Duration
+	payload := block.Payload
+	if len(block.Digests) > 0 {
+		txns, ok := r.worker.Payload(block.ID, block.Digests, block.Proposer, r.batchesArrived)
+		if !ok {
+			r.logger.Debugw("waits for the batches of a committed block", "batches", len(block.Digests), "view", block.View, "block_id", block.ID)
+			return false
 		}
+		payload = append(payload, txns...)
+	}
+	for _, txn := range payload {
+		value, err := r.execute(txn)
+		// only record the delay of transactions whose clients wait at this replica
+		if local := r.waiting.remove(txn.ID); local != nil {
+			latencies = append(latencies, r.reply(local, value, err))
+		}
+	}
+	// copies of the transactions submitted to this replica as well are not proposed again
+	r.pd.Committed(payload)
+	r.worker.Committed(block.Digests)
+	r.committed.append(block)
+	r.traces.commit(block)
+	r.stats.commit(len(payload), latencies)
+	r.logger.Infow("the block is committed", "transactions", len(payload), "batches", len(block.Digests), "view", block.View, "current_view", r.pm.GetCurView(), "block_id", block.ID)
+	return true
+}
+
+// batchesArrived wakes up the committed blocks waiting for their batches
+func (r *Replica) batchesArrived() {
+	select {
+	case r.available <- struct{}{}:
+	default:
 	}
-	r.committedNo++
-	r.totalCommittedTx += len(block.Payload)
-	log.Infof("[%v] the block is committed, No. of transactions: %v, view: %v, current view: %v, id: %x", r.ID(), len(block.Payload), block.View, r.pm.GetCurView(), block.ID)
 }
 
 func (r *Replica) processForkedBlock(block *blockchain.Block) {
+	r.stats.fork()
 	if block.Proposer == r.ID() {
 		for _, txn := range block.Payload {
-			// collect txn back to mem pool
+			// collect txn back to mem pool unless another block committed it
 			r.pd.CollectTxn(txn)
 		}
+		r.worker.Requeue(block.Digests)
+	}
+	r.logger.Debugw("the block is forked", "transactions", len(block.Payload), "batches", len(block.Digests), "view", block.View, "current_view", r.pm.GetCurView(), "block_id", block.ID)
+}
+
+// reply answers the client waiting for the commitment of the transaction and returns its delay
+func (r *Replica) reply(txn *message.Transaction, value db.Value, err error) time.Duration {
+	delay := time.Now().Sub(txn.Timestamp)
+	if txn.C != nil {
+		reply := message.NewReply(delay)
+		reply.Command = txn.Command
+		reply.Value = value
+		reply.Err = err
+		txn.Reply(reply)
+		txn.C = nil
 	}
-	log.Infof("[%v] the block is forked, No. of transactions: %v, view: %v, current view: %v, id: %x", r.ID(), len(block.Payload), block.View, r.pm.GetCurView(), block.ID)
+	return delay
 }
 
 func (r *Replica) processNewView(newView types.View) {
-	log.Debugf("[%v] is processing new view: %v, leader is %v", r.ID(), newView, r.FindLeaderFor(newView))
+	r.logger.Debugw("is processing new view", "view", newView, "leader", r.FindLeaderFor(newView))
 	// if !r.IsLeader(r.ID(), newView) {
 	// 	return
 	// }
@@ -203,21 +364,37 @@ func (r *Replica) processNewView(newView types.View) {
 	// if flag && randomValue < 0.5 {
 	// 	return
 	// }
+	r.requestHeaders(newView - 1)
 	r.proposeBlock(newView)
 }
 
 func (r *Replica) proposeBlock(view types.View) {
-	createStart := time.Now()
-	block := r.Safety.MakeProposal(view, r.pd.GeneratePayload())
-	r.totalBlockSize += len(block.Payload)
-	r.proposedNo++
-	createEnd := time.Now()
-	createDuration := createEnd.Sub(createStart)
+	var block *blockchain.Block
+	if r.worker != nil {
+		// the batches are disseminated already, the block refers to them
+		digests, txs := r.worker.Propose(r.pd.BlockLimit())
+		block = r.Safety.MakeProposal(view, nil, digests)
+		r.stats.propose(txs)
+	} else {
+		block = r.Safety.MakeProposal(view, r.pd.GeneratePayload(), nil)
+		r.stats.propose(len(block.Payload))
+	}
 	block.Timestamp = time.Now()
-	r.totalCreateDuration += createDuration
-	r.Broadcast(block)
-	_ = r.Safety.ProcessBlock(block)
-	r.voteStart = time.Now()
+	span := r.traces.propose(block)
+	proposals := r.byz.Propose(block, config.GetConfig().IDs())
+	for id, blocks := range proposals {
+		if id == r.ID() {
+			continue
+		}
+		for _, b := range blocks {
+			r.Send(id, b)
+		}
+	}
+	span.Finish()
+	for _, b := range proposals[r.ID()] {
+		_ = r.Safety.ProcessBlock(b)
+	}
+	r.traces.qc(r.Safety.GetHighQC())
 }
 
 // ListenLocalEvent listens new view and timeout events
@@ -230,19 +407,17 @@ func (r *Replica) ListenLocalEvent() {
 		for {
 			select {
 			case view := <-r.pm.EnteringViewEvent():
-				if view >= 2 {
-					r.totalVoteTime += time.Now().Sub(r.voteStart)
-				}
 				// measure round time
 				now := time.Now()
 				lasts := now.Sub(r.lastViewTime)
-				r.totalRoundTime += lasts
-				r.roundNo++
+				r.stats.round(lasts)
+				r.pd.Round(lasts)
 				r.lastViewTime = now
 				r.eventChan <- view
-				log.Debugf("[%v] the last view lasts %v milliseconds, current view: %v", r.ID(), lasts.Milliseconds(), view)
+				r.logger.Debugw("the last view ended", "duration_ms", lasts.Milliseconds(), "view", view)
 				break L
 			case <-r.timer.C:
+				r.stats.timeout()
 				r.Safety.ProcessLocalTmo(r.pm.GetCurView())
 				break L
 			}
@@ -250,28 +425,52 @@ func (r *Replica) ListenLocalEvent() {
 	}
 }
 
-// ListenCommittedBlocks listens committed blocks and forked blocks from the protocols
+// ListenCommittedBlocks listens committed blocks and forked blocks from the protocols, the
+// committed blocks are executed in order and queue up behind a block missing its batches
 func (r *Replica) ListenCommittedBlocks() {
+	var pending []*blockchain.Block
 	for {
 		select {
 		case committedBlock := <-r.committedBlocks:
-			r.processCommittedBlock(committedBlock)
+			pending = append(pending, committedBlock)
+			if len(pending) > 1 {
+				// the first one waits for its batches and wakes up the queue
+				continue
+			}
 		case forkedBlock := <-r.forkedBlocks:
 			r.processForkedBlock(forkedBlock)
+			continue
+		case <-r.available:
+		}
+		for len(pending) > 0 && r.processCommittedBlock(pending[0]) {
+			pending = pending[1:]
 		}
 	}
 }
 
 func (r *Replica) startSignal() {
-	if !r.isStarted.Load() {
+	// transactions and blocks are handled concurrently, only one of them signals
+	if r.isStarted.CAS(false, true) {
 		r.startTime = time.Now()
-		r.tmpTime = time.Now()
-		log.Debugf("[%v] is boosting", r.ID())
-		r.isStarted.Store(true)
+		r.logger.Debugw("is boosting")
 		r.start <- true
 	}
 }
 
+// availableBlock is a received block whose batches have arrived
+type availableBlock struct {
+	blockchain.Block
+}
+
+func (r *Replica) processBlock(block *blockchain.Block) {
+	span := r.traces.receive(block)
+	startProcessTime := time.Now()
+	_ = r.Safety.ProcessBlock(block)
+	r.stats.block(block, time.Now().Sub(startProcessTime))
+	span.Finish()
+	r.traces.qc(r.Safety.GetHighQC())
+}
+
 // Start starts event loop
 func (r *Replica) Start() {
 	go r.Run()
@@ -279,26 +478,37 @@ func (r *Replica) Start() {
 	<-r.start
 	go r.ListenLocalEvent()
 	go r.ListenCommittedBlocks()
+	if r.worker != nil {
+		go r.worker.Run()
+	}
 	for r.isStarted.Load() {
 		event := <-r.eventChan
 		switch v := event.(type) {
 		case types.View:
 			r.processNewView(v)
 		case blockchain.Block:
-			startProcessTime := time.Now()
-			r.totalProposeDuration += startProcessTime.Sub(v.Timestamp)
-			_ = r.Safety.ProcessBlock(&v)
-			r.totalProcessDuration += time.Now().Sub(startProcessTime)
-			r.voteStart = time.Now()
-			r.processedNo++
+			r.processEvidence(r.detector.AddBlock(&v))
+			// the block is voted for once its batches are available
+			block := v
+			if r.worker.Await(v.ID, v.Digests, v.Proposer, func() { go func() { r.eventChan <- availableBlock{block} }() }) {
+				r.processBlock(&v)
+			}
+		case availableBlock:
+			r.processBlock(&v.Block)
 		case blockchain.Vote:
+			r.processEvidence(r.detector.AddVote(&v))
 			startProcessTime := time.Now()
 			r.Safety.ProcessVote(&v)
-			processingDuration := time.Now().Sub(startProcessTime)
-			r.totalVoteTime += processingDuration
-			r.voteNo++
+			r.traces.qc(r.Safety.GetHighQC())
+			r.stats.vote(time.Now().Sub(startProcessTime))
 		case pacemaker.TMO:
 			r.Safety.ProcessRemoteTmo(&v)
+		case blockchain.HeaderRequest:
+			if h, ok := r.detector.Header(v.BlockID); ok {
+				r.Send(v.Requester, *h)
+			}
+		case blockchain.Header:
+			r.processEvidence(r.detector.AddHeader(&v))
 		}
 	}
 }
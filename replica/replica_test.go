@@ -0,0 +1,83 @@
+package replica
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/election"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/node"
+	"github.com/gitferry/bamboo/pacemaker"
+)
+
+func TestMain(m *testing.M) {
+	if err := crypto.GenerateKeys(4); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// broadcastNode records the broadcast messages instead of sending them
+type broadcastNode struct {
+	node.Node
+	id identity.NodeID
+
+	mu   sync.Mutex
+	sent []interface{}
+}
+
+func (n *broadcastNode) ID() identity.NodeID {
+	return n.id
+}
+
+func (n *broadcastNode) Broadcast(m interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, m)
+}
+
+func (n *broadcastNode) Send(to identity.NodeID, m interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent = append(n.sent, m)
+}
+
+func (n *broadcastNode) batches() []mempool.Batch {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	batches := make([]mempool.Batch, 0, len(n.sent))
+	for _, m := range n.sent {
+		batches = append(batches, m.(mempool.Batch))
+	}
+	return batches
+}
+
+// newTestReplica makes a replica of four handling transactions, blocks and evidence without sockets
+func newTestReplica(id identity.NodeID) *Replica {
+	return &Replica{
+		Node:      &broadcastNode{id: id},
+		Election:  election.NewRotation(4),
+		pd:        mempool.NewProducer(),
+		pm:        pacemaker.NewPacemaker(4),
+		start:     make(chan bool, 1),
+		committed: new(committedLog),
+		evidence:  newEvidencePool(),
+		stats:     newStats(),
+		logger:    log.With("node", id),
+		db:        db.NewDatabase(),
+		executed:  newExecutedSet(executedWindow),
+		waiting:   newWaiting(),
+	}
+}
+
+func put(cid int) *message.Transaction {
+	cmd := db.Command{Key: db.Key(cid), Value: db.Value("v"), ClientID: "c", CommandID: cid}
+	return &message.Transaction{ID: "c." + strconv.Itoa(cid), Command: cmd, C: make(chan message.TransactionReply, 1)}
+}
@@ -2,6 +2,7 @@ package replica
 
 import (
 	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/crypto"
 	"github.com/gitferry/bamboo/message"
 	"github.com/gitferry/bamboo/pacemaker"
 	"github.com/gitferry/bamboo/types"
@@ -12,6 +13,7 @@ type Safety interface {
 	ProcessVote(vote *blockchain.Vote)
 	ProcessRemoteTmo(tmo *pacemaker.TMO)
 	ProcessLocalTmo(view types.View)
-	MakeProposal(view types.View, payload []*message.Transaction) *blockchain.Block
+	MakeProposal(view types.View, payload []*message.Transaction, digests []crypto.Identifier) *blockchain.Block
 	GetChainStatus() string
+	GetHighQC() *blockchain.QC
 }
@@ -0,0 +1,258 @@
+package replica
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/metrics"
+)
+
+// statsHistory is the number of seconds of committed transactions kept for the throughput windows
+const statsHistory = 60
+
+// latencySamples is the number of the latest commit latencies the percentiles are taken from
+const latencySamples = 10000
+
+// throughputWindows are the windows in seconds over which the throughput is reported
+var throughputWindows = []int{1, 10, 60}
+
+type second struct {
+	unix int64
+	txs  uint64
+}
+
+// stats holds the statistics of the replica, counters only ever grow so that
+// any number of observers may poll them
+type stats struct {
+	registry *metrics.Registry
+	start    time.Time
+
+	committedTxs    *metrics.Counter
+	committedBlocks *metrics.Counter
+	proposedBlocks  *metrics.Counter
+	receivedBlocks  *metrics.Counter
+	forkedBlocks    *metrics.Counter
+	votes           *metrics.Counter
+	timeouts        *metrics.Counter
+	relayedTxs      *metrics.Counter
+	messages        *metrics.CounterVec
+	messageBytes    *metrics.CounterVec
+	commitLatency   *metrics.Histogram
+	roundTime       *metrics.Histogram
+	blockTime       *metrics.Histogram
+	voteTime        *metrics.Histogram
+	blockSize       *metrics.Histogram
+	qcSize          *metrics.Histogram
+
+	mu        sync.Mutex
+	seconds   [statsHistory]second // committed transactions per second
+	latencies []time.Duration      // ring of the latest commit latencies
+	next      int
+}
+
+func newStats() *stats {
+	r := metrics.NewRegistry()
+	sizes := []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024, 2048, 4096}
+	return &stats{
+		registry:        r,
+		start:           time.Now(),
+		latencies:       make([]time.Duration, 0, latencySamples),
+		committedTxs:    r.NewCounter("bamboo_committed_transactions_total", "Transactions committed."),
+		committedBlocks: r.NewCounter("bamboo_committed_blocks_total", "Blocks committed."),
+		proposedBlocks:  r.NewCounter("bamboo_proposed_blocks_total", "Blocks proposed by the replica."),
+		receivedBlocks:  r.NewCounter("bamboo_received_blocks_total", "Blocks received from other replicas."),
+		forkedBlocks:    r.NewCounter("bamboo_forked_blocks_total", "Blocks pruned without being committed."),
+		votes:           r.NewCounter("bamboo_votes_total", "Votes processed."),
+		timeouts:        r.NewCounter("bamboo_timeouts_total", "Views timed out locally."),
+		relayedTxs:      r.NewCounter("bamboo_relayed_transactions_total", "Transactions relayed to the other replicas."),
+		messages:        r.NewCounterVec("bamboo_messages_sent_total", "Messages sent by type.", "type"),
+		messageBytes:    r.NewCounterVec("bamboo_message_sent_bytes_total", "Encoded bytes of the messages sent by type.", "type"),
+		commitLatency:   r.NewHistogram("bamboo_commit_latency_seconds", "Time from receiving a transaction to committing it, for transactions submitted to the replica.", metrics.DefBuckets),
+		roundTime:       r.NewHistogram("bamboo_round_duration_seconds", "Duration of a view.", metrics.DefBuckets),
+		blockTime:       r.NewHistogram("bamboo_block_processing_seconds", "Time to process a received block.", metrics.DefBuckets),
+		voteTime:        r.NewHistogram("bamboo_vote_processing_seconds", "Time to process a vote.", metrics.DefBuckets),
+		blockSize:       r.NewHistogram("bamboo_block_transactions", "Transactions in the blocks proposed by the replica.", sizes),
+		qcSize:          r.NewHistogram("bamboo_qc_signers", "Signers of the quorum certificates of received blocks.", sizes),
+	}
+}
+
+// registerGauges registers the gauges read from the replica at every scrape
+func (r *Replica) registerGauges() {
+	r.stats.registry.NewGaugeFunc("bamboo_view", "Current view.", func() float64 {
+		return float64(r.pm.GetCurView())
+	})
+	r.stats.registry.NewGaugeFunc("bamboo_committed_height", "Blocks in the committed chain.", func() float64 {
+		return float64(r.committed.height())
+	})
+	r.stats.registry.NewGaugeFunc("bamboo_mempool_size", "Transactions waiting in the memory pool.", func() float64 {
+		return float64(r.pd.Size())
+	})
+	r.stats.registry.NewGaugeFunc("bamboo_mempool_bytes", "Payload bytes of the transactions in the memory pool.", func() float64 {
+		return float64(r.pd.Bytes())
+	})
+	r.stats.registry.NewGaugeFunc("bamboo_block_limit", "Transactions the next block is filled up to.", func() float64 {
+		return float64(r.pd.BlockLimit())
+	})
+}
+
+func (s *stats) commit(txs int, latencies []time.Duration) {
+	s.committedBlocks.Inc()
+	s.committedTxs.Add(float64(txs))
+	for _, l := range latencies {
+		s.commitLatency.Observe(l.Seconds())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().Unix()
+	sec := &s.seconds[now%statsHistory]
+	if sec.unix != now {
+		*sec = second{unix: now}
+	}
+	sec.txs += uint64(txs)
+	for _, l := range latencies {
+		if len(s.latencies) < latencySamples {
+			s.latencies = append(s.latencies, l)
+			continue
+		}
+		s.latencies[s.next] = l
+		s.next = (s.next + 1) % latencySamples
+	}
+}
+
+func (s *stats) relay(txs int) {
+	s.relayedTxs.Add(float64(txs))
+}
+
+func (s *stats) propose(txs int) {
+	s.proposedBlocks.Inc()
+	s.blockSize.Observe(float64(txs))
+}
+
+func (s *stats) block(b *blockchain.Block, d time.Duration) {
+	s.receivedBlocks.Inc()
+	s.blockTime.Observe(d.Seconds())
+	if b.QC != nil {
+		s.qcSize.Observe(float64(len(b.QC.Signers)))
+	}
+}
+
+func (s *stats) vote(d time.Duration) {
+	s.votes.Inc()
+	s.voteTime.Observe(d.Seconds())
+}
+
+func (s *stats) round(d time.Duration) {
+	s.roundTime.Observe(d.Seconds())
+}
+
+func (s *stats) fork() {
+	s.forkedBlocks.Inc()
+}
+
+func (s *stats) timeout() {
+	s.timeouts.Inc()
+}
+
+// sent counts the messages sent and their encoded bytes by type
+func (s *stats) sent(m interface{}, bytes int) {
+	t := reflect.TypeOf(m)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	s.messages.With(t.String()).Inc()
+	s.messageBytes.With(t.String()).Add(float64(bytes))
+}
+
+// throughput returns the committed transactions per second over the last complete w seconds,
+// or since the start if the replica is up for less than w seconds
+func (s *stats) throughput(w int) float64 {
+	now := time.Now().Unix()
+	if up := int(now - s.start.Unix()); up < w {
+		if up == 0 {
+			return 0
+		}
+		w = up
+	}
+	var txs uint64
+	for _, sec := range s.seconds {
+		if sec.unix >= now-int64(w) && sec.unix < now {
+			txs += sec.txs
+		}
+	}
+	return float64(txs) / float64(w)
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / float64(time.Millisecond)
+}
+
+func (s *stats) latency() message.LatencyStats {
+	if len(s.latencies) == 0 {
+		return message.LatencyStats{}
+	}
+	l := make([]time.Duration, len(s.latencies))
+	copy(l, s.latencies)
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	var sum time.Duration
+	for _, d := range l {
+		sum += d
+	}
+	percentile := func(p float64) float64 {
+		return ms(l[int(p*float64(len(l)-1))])
+	}
+	return message.LatencyStats{
+		Mean:   ms(sum / time.Duration(len(l))),
+		Median: percentile(0.5),
+		P95:    percentile(0.95),
+		P99:    percentile(0.99),
+		Max:    ms(l[len(l)-1]),
+	}
+}
+
+// snapshot returns the statistics without changing them, the committed transactions, blocks and
+// latencies cover every block committed, not only the ones the replica proposed
+func (s *stats) snapshot() message.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := message.Stats{
+		Uptime:          time.Since(s.start).Seconds(),
+		CommittedTxs:    uint64(s.committedTxs.Value()),
+		CommittedBlocks: uint64(s.committedBlocks.Value()),
+		ProposedBlocks:  uint64(s.proposedBlocks.Value()),
+		ForkedBlocks:    uint64(s.forkedBlocks.Value()),
+		Timeouts:        uint64(s.timeouts.Value()),
+		Throughput:      make(map[string]float64),
+		Latency:         s.latency(),
+	}
+	for _, w := range throughputWindows {
+		st.Throughput[strconv.Itoa(w)+"s"] = s.throughput(w)
+	}
+	return st
+}
+
+// handleQuery replies a query with the statistics of the node
+func (r *Replica) handleQuery(m message.Query) {
+	st := r.stats.snapshot()
+	st.View = r.pm.GetCurView()
+	st.Height = r.committed.height()
+	st.MempoolSize = r.pd.Size()
+	st.MempoolBytes = r.pd.Bytes()
+	st.ReceivedTxs = r.pd.TotalReceivedTxNo()
+	m.Reply(message.QueryReply{Stats: st})
+}
+
+// handleMetricsQuery replies with the metrics in the Prometheus text format
+func (r *Replica) handleMetricsQuery(m message.MetricsQuery) {
+	var b bytes.Buffer
+	if _, err := r.stats.registry.WriteTo(&b); err != nil {
+		log.Error(err)
+	}
+	m.Reply(message.MetricsReply{Metrics: b.Bytes()})
+}
@@ -0,0 +1,64 @@
+package replica
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsCounters(t *testing.T) {
+	s := newStats()
+	s.commit(3, []time.Duration{time.Millisecond, 3 * time.Millisecond})
+	s.propose(3)
+	s.fork()
+	s.timeout()
+
+	// polling leaves the counters as they are, they only grow
+	first := s.snapshot()
+	require.Equal(t, first.CommittedTxs, s.snapshot().CommittedTxs)
+	require.Equal(t, uint64(3), first.CommittedTxs)
+	require.Equal(t, uint64(1), first.CommittedBlocks)
+	require.Equal(t, 2.0, first.Latency.Mean)
+	require.Equal(t, 3.0, first.Latency.Max)
+	s.commit(2, nil)
+	s.commit(0, nil)
+	second := s.snapshot()
+	require.Equal(t, uint64(5), second.CommittedTxs)
+	require.Equal(t, uint64(3), second.CommittedBlocks)
+	require.Equal(t, first.ProposedBlocks, second.ProposedBlocks)
+	require.Equal(t, first.ForkedBlocks, second.ForkedBlocks)
+	require.Equal(t, first.Timeouts, second.Timeouts)
+	require.Equal(t, first.Latency, second.Latency)
+}
+
+// throughputs fills the uptime and the committed transactions per second relative to the current
+// second and returns the throughput of the windows, it retries when the second changes meanwhile
+func throughputs(s *stats, up int64, txs map[int64]uint64, windows ...int) []float64 {
+	for {
+		now := time.Now().Unix()
+		s.start = time.Unix(now-up, 0)
+		s.seconds = [statsHistory]second{}
+		for ago, n := range txs {
+			s.seconds[(now-ago)%statsHistory] = second{unix: now - ago, txs: n}
+		}
+		var tps []float64
+		for _, w := range windows {
+			tps = append(tps, s.throughput(w))
+		}
+		if time.Now().Unix() == now {
+			return tps
+		}
+	}
+}
+
+func TestStatsThroughput(t *testing.T) {
+	s := newStats()
+	// the current second is not complete and left out
+	txs := map[int64]uint64{0: 1000, 1: 10, 5: 20, 30: 60}
+	require.Equal(t, []float64{10, 3, 1.5}, throughputs(s, 3600, txs, 1, 10, 60))
+
+	// a replica up for less than the window averages over its uptime
+	require.Equal(t, []float64{5}, throughputs(s, 2, txs, 10))
+	require.Equal(t, []float64{0}, throughputs(s, 0, txs, 10))
+}
@@ -0,0 +1,141 @@
+package replica
+
+import (
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/blockchain"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/trace"
+	"github.com/gitferry/bamboo/types"
+)
+
+// traceWindow is the number of views the blocks are followed for
+const traceWindow = 100
+
+type blockTrace struct {
+	ctx      trace.Context // context of the proposal
+	view     types.View
+	received time.Time
+	qc       bool
+}
+
+// blockTraces follows the blocks through their lifecycle at the replica, from the proposal
+// or receipt to the vote, the QC and the commit, all methods of nil blockTraces do nothing
+type blockTraces struct {
+	tracer *trace.Tracer
+	node   string
+
+	mu     sync.Mutex
+	blocks map[crypto.Identifier]*blockTrace
+}
+
+// newBlockTraces returns nil if tracing is disabled
+func newBlockTraces(id identity.NodeID) *blockTraces {
+	tracer := trace.New(string(id))
+	if tracer == nil {
+		return nil
+	}
+	return &blockTraces{
+		tracer: tracer,
+		node:   string(id),
+		blocks: make(map[crypto.Identifier]*blockTrace),
+	}
+}
+
+func (t *blockTraces) attributes(view types.View, id crypto.Identifier) []trace.Attribute {
+	return []trace.Attribute{
+		trace.String("node", t.node),
+		trace.Int("view", int64(view)),
+		trace.String("block_id", hex.EncodeToString(id[:])),
+	}
+}
+
+func (t *blockTraces) add(block *blockchain.Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.blocks[block.ID]; exists {
+		return
+	}
+	t.blocks[block.ID] = &blockTrace{ctx: block.Trace, view: block.View, received: time.Now()}
+}
+
+func (t *blockTraces) get(id crypto.Identifier) (*blockTrace, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.blocks[id]
+	return b, ok
+}
+
+// propose starts the trace of the block, the span ends when the block is sent
+func (t *blockTraces) propose(block *blockchain.Block) *trace.Span {
+	if t == nil {
+		return nil
+	}
+	span := t.tracer.Start("propose", trace.Context{}, t.attributes(block.View, block.ID)...)
+	span.SetAttributes(trace.Int("transactions", int64(len(block.Payload))))
+	block.Trace = span.Context()
+	t.add(block)
+	return span
+}
+
+// receive starts the span of processing a block received from the proposer
+func (t *blockTraces) receive(block *blockchain.Block) *trace.Span {
+	if t == nil {
+		return nil
+	}
+	t.add(block)
+	span := t.tracer.Start("receive", block.Trace, t.attributes(block.View, block.ID)...)
+	span.SetAttributes(trace.String("proposer", string(block.Proposer)))
+	return span
+}
+
+// vote records the time from the receipt of the block until the vote is sent
+func (t *blockTraces) vote(vote *blockchain.Vote, to identity.NodeID) {
+	if t == nil {
+		return
+	}
+	b, ok := t.get(vote.BlockID)
+	if !ok {
+		return
+	}
+	attrs := append(t.attributes(vote.View, vote.BlockID), trace.String("aggregator", string(to)))
+	t.tracer.Record("vote", b.ctx, b.received, time.Now(), attrs...)
+}
+
+// qc records the time from the receipt of the block until its QC is formed by the replica
+func (t *blockTraces) qc(qc *blockchain.QC) {
+	if t == nil || qc == nil || string(qc.Leader) != t.node {
+		return
+	}
+	t.mu.Lock()
+	b, ok := t.blocks[qc.BlockID]
+	if !ok || b.qc {
+		t.mu.Unlock()
+		return
+	}
+	b.qc = true
+	t.mu.Unlock()
+	attrs := append(t.attributes(qc.View, qc.BlockID), trace.Int("signers", int64(len(qc.Signers))))
+	t.tracer.Record("qc", b.ctx, b.received, time.Now(), attrs...)
+}
+
+// commit records the time from the receipt of the block until it is committed and
+// forgets the blocks out of the window
+func (t *blockTraces) commit(block *blockchain.Block) {
+	if t == nil {
+		return
+	}
+	if b, ok := t.get(block.ID); ok {
+		t.tracer.Record("commit", b.ctx, b.received, time.Now(), t.attributes(block.View, block.ID)...)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, b := range t.blocks {
+		if b.view+traceWindow < block.View {
+			delete(t.blocks, id)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"flag"
-	"strconv"
 	"sync"
 
 	"github.com/gitferry/bamboo"
@@ -41,20 +40,11 @@ func main() {
 		wg.Add(1)
 		config.Simulation()
 		for id := range config.GetConfig().Addrs {
-			isByz := false
-			if id.Node() <= config.GetConfig().ByzNo {
-				isByz = true
-			}
-			go initReplica(id, isByz)
+			go initReplica(id, config.GetConfig().IsByzantine(id))
 		}
 		wg.Wait()
 	} else {
 		setupDebug()
-		isByz := false
-		i, _ := strconv.Atoi(*id)
-		if i <= config.GetConfig().ByzNo {
-			isByz = true
-		}
-		initReplica(identity.NodeID(*id), isByz)
+		initReplica(identity.NodeID(*id), config.GetConfig().IsByzantine(identity.NodeID(*id)))
 	}
 }
@@ -28,6 +28,9 @@ type Socket interface {
 
 	Close()
 
+	// SetMeter sets the meter told the encoded size of every message sent
+	SetMeter(meter transport.Meter)
+
 	// Fault injection
 	Drop(id identity.NodeID, t int)             // drops every message send to NodeID last for t seconds
 	Slow(id identity.NodeID, d int, t int)      // delays every message send to NodeID for d ms and last for t seconds
@@ -39,6 +42,7 @@ type socket struct {
 	id        identity.NodeID
 	addresses map[identity.NodeID]string
 	nodes     map[identity.NodeID]transport.Transport
+	meter     transport.Meter
 
 	crash bool
 	drop  map[identity.NodeID]bool
@@ -95,6 +99,9 @@ func (s *socket) Send(to identity.NodeID, m interface{}) {
 			return
 		}
 		t = transport.NewTransport(address)
+		s.lock.RLock()
+		t.SetMeter(s.meter)
+		s.lock.RUnlock()
 		err := utils.Retry(t.Dial, 100, time.Duration(50)*time.Millisecond)
 		if err != nil {
 			panic(err)
@@ -171,6 +178,17 @@ func (s *socket) Broadcast(m interface{}) {
 	//log.Debugf("node %s done  broadcasting message %+v", s.id, m)
 }
 
+func (s *socket) SetMeter(meter transport.Meter) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.meter = meter
+	for id, t := range s.nodes {
+		if id != s.id {
+			t.SetMeter(meter)
+		}
+	}
+}
+
 func (s *socket) Close() {
 	for _, t := range s.nodes {
 		t.Close()
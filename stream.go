@@ -0,0 +1,170 @@
+package bamboo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/node"
+)
+
+// Batch submits the transactions to the node in one request and returns their acks in order,
+// the command ids of the submissions without one are assigned by the client
+func (c *HTTPClient) Batch(id identity.NodeID, subs []node.Submission) ([]node.Ack, error) {
+	for i := range subs {
+		if err := c.assign(&subs[i]); err != nil {
+			return nil, err
+		}
+	}
+	body, err := json.Marshal(subs)
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.Client.Post(c.HTTP[id]+"/batch", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return nil, errors.New(r.Status)
+	}
+	var acks []node.Ack
+	err = json.NewDecoder(r.Body).Decode(&acks)
+	return acks, err
+}
+
+// assign fills the client and command ids of the submission and signs it if the client has a key
+func (c *HTTPClient) assign(s *node.Submission) error {
+	if s.ClientID == "" {
+		s.ClientID = c.ID
+	}
+	if s.CommandID == 0 {
+		s.CommandID = c.nextCID()
+	}
+	if s.Signature != "" {
+		return nil
+	}
+	var err error
+	s.PubKey, s.Signature, err = c.sign(db.Command{Key: s.Key, Value: s.Value, ClientID: s.ClientID, CommandID: s.CommandID}, s.Fee)
+	return err
+}
+
+// Stream submits transactions to the node and receives their acks in the order of commitment,
+// the acks are streamed on one request while the submissions are streamed on another
+type Stream struct {
+	url    string // of the stream, with its id
+	client *HTTPClient
+	http   *http.Client
+	acks   chan node.Ack
+	body   io.ReadCloser // of the acks
+
+	mu     sync.Mutex // guards the encoder
+	enc    *json.Encoder
+	w      *io.PipeWriter // body of the post of the submissions
+	posted chan error
+}
+
+// Stream opens a stream to the node
+func (c *HTTPClient) Stream(id identity.NodeID) (*Stream, error) {
+	// the requests of a stream last as long as it does
+	client := &http.Client{Transport: c.Client.Transport}
+	r, err := client.Get(c.HTTP[id] + "/stream")
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK || r.Header.Get(node.StreamHeader) == "" {
+		r.Body.Close()
+		return nil, errors.New(r.Status)
+	}
+	pr, pw := io.Pipe()
+	s := &Stream{
+		url:    c.HTTP[id] + "/stream?id=" + url.QueryEscape(r.Header.Get(node.StreamHeader)),
+		client: c,
+		http:   client,
+		acks:   make(chan node.Ack, 1024),
+		body:   r.Body,
+		enc:    json.NewEncoder(pw),
+		w:      pw,
+		posted: make(chan error, 1),
+	}
+	go s.receive()
+	go s.post(pr)
+	return s, nil
+}
+
+func (s *Stream) receive() {
+	defer close(s.acks)
+	dec := json.NewDecoder(s.body)
+	for {
+		var a node.Ack
+		if err := dec.Decode(&a); err != nil {
+			return
+		}
+		s.acks <- a
+	}
+}
+
+// post streams the submissions written to the pipe to the node
+func (s *Stream) post(body *io.PipeReader) {
+	r, err := s.http.Post(s.url, "application/x-ndjson", body)
+	if err == nil {
+		if r.StatusCode != http.StatusNoContent {
+			err = errors.New(r.Status)
+		}
+		r.Body.Close()
+	}
+	// the submissions written after a failed post fail as well
+	body.CloseWithError(err)
+	s.posted <- err
+}
+
+// Submit sends the transaction without waiting for its ack and returns its command id, it blocks
+// while the node holds as many submissions waiting for their acks as it allows
+func (s *Stream) Submit(sub node.Submission) (int, error) {
+	if err := s.client.assign(&sub); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sub.CommandID, s.enc.Encode(sub)
+}
+
+// Acks returns the acks of the submitted transactions, closed when the node ends the stream
+func (s *Stream) Acks() <-chan node.Ack {
+	return s.acks
+}
+
+// CloseSend tells the node that no more transactions follow, the remaining acks still arrive
+func (s *Stream) CloseSend() error {
+	s.mu.Lock()
+	s.w.Close()
+	s.mu.Unlock()
+	if err := <-s.posted; err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodDelete, s.url, nil)
+	if err != nil {
+		return err
+	}
+	r, err := s.client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusNoContent {
+		return errors.New(r.Status)
+	}
+	return nil
+}
+
+// Close closes the stream, the acks not received are lost
+func (s *Stream) Close() error {
+	s.w.CloseWithError(errors.New("stream closed"))
+	return s.body.Close()
+}
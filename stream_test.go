@@ -0,0 +1,124 @@
+package bamboo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/node"
+	"github.com/stretchr/testify/require"
+)
+
+// echo acks a submission with its own value
+func echo(s node.Submission) node.Ack {
+	return node.Ack{ID: string(s.ClientID) + "." + strconv.Itoa(s.CommandID), CommandID: s.CommandID, Status: http.StatusOK, Value: s.Value}
+}
+
+// newEchoServer serves /batch and one /stream, every submission is acked at once with echo
+func newEchoServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/batch", func(w http.ResponseWriter, r *http.Request) {
+		var subs []node.Submission
+		if err := json.NewDecoder(r.Body).Decode(&subs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(subs) > 2 {
+			http.Error(w, "too many transactions in the batch", http.StatusRequestEntityTooLarge)
+			return
+		}
+		acks := make([]node.Ack, len(subs))
+		for i, s := range subs {
+			acks[i] = echo(s)
+		}
+		json.NewEncoder(w).Encode(acks)
+	})
+	// a single stream whose acks end when it is deleted
+	acks := make(chan node.Ack, 16)
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set(node.StreamHeader, "1")
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			enc := json.NewEncoder(w)
+			for a := range acks {
+				enc.Encode(a)
+				w.(http.Flusher).Flush()
+			}
+		case http.MethodPost:
+			dec := json.NewDecoder(r.Body)
+			for {
+				var s node.Submission
+				if dec.Decode(&s) != nil {
+					break
+				}
+				acks <- echo(s)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			close(acks)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func newTestClient(url string) *HTTPClient {
+	return &HTTPClient{
+		ID:     "c",
+		HTTP:   map[identity.NodeID]string{"1": url},
+		Client: http.DefaultClient,
+	}
+}
+
+func TestBatch(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := newTestClient(server.URL)
+
+	acks, err := c.Batch("1", []node.Submission{{Key: 1, Value: db.Value("a")}, {Key: 2, CommandID: 7}})
+	require.NoError(t, err)
+	// the client fills in its id and the missing command ids
+	require.Equal(t, []node.Ack{
+		{ID: "c.1", CommandID: 1, Status: http.StatusOK, Value: db.Value("a")},
+		{ID: "c.7", CommandID: 7, Status: http.StatusOK},
+	}, acks)
+
+	_, err = c.Batch("1", make([]node.Submission, 3))
+	require.EqualError(t, err, "413 Request Entity Too Large")
+}
+
+func TestStream(t *testing.T) {
+	server := newEchoServer()
+	defer server.Close()
+	c := newTestClient(server.URL)
+
+	s, err := c.Stream("1")
+	require.NoError(t, err)
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		cid, err := s.Submit(node.Submission{Key: db.Key(i), Value: db.Value(strconv.Itoa(i))})
+		require.NoError(t, err)
+		require.Equal(t, i+1, cid)
+	}
+	require.NoError(t, s.CloseSend())
+	var acks []node.Ack
+	for a := range s.Acks() {
+		acks = append(acks, a)
+	}
+	require.Len(t, acks, 3)
+	for i, a := range acks {
+		require.Equal(t, "c."+strconv.Itoa(i+1), a.ID)
+		require.Equal(t, db.Value(strconv.Itoa(i)), a.Value)
+	}
+
+	// a node not serving streams fails the stream
+	c.HTTP["1"] = server.URL + "/batch"
+	_, err = c.Stream("1")
+	require.Error(t, err)
+}
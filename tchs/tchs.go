@@ -112,7 +112,7 @@ func (th *Tchs) ProcessBlock(block *blockchain.Block) error {
 
 	shouldVote, err := th.votingRule(block)
 	if err != nil {
-		log.Errorf("cannot decide whether to vote the block, %w", err)
+		log.Errorf("cannot decide whether to vote the block, %v", err)
 		return err
 	}
 	if !shouldVote {
@@ -193,7 +193,7 @@ func (th *Tchs) ProcessLocalTmo(view types.View) {
 
 func (th *Tchs) MakeProposal(view types.View, payload []*message.Transaction) *blockchain.Block {
 	qc := th.forkChoice()
-	block := blockchain.MakeBlock(view, qc, qc.BlockID, payload, th.ID())
+	block := blockchain.MakeBlock(view, qc, qc.BlockID, payload, nil, th.ID())
 	return block
 }
 
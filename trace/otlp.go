@@ -0,0 +1,166 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the OTLP JSON encoding of ExportTraceServiceRequest
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// spanKindInternal is the OTLP kind of spans not crossing a process boundary
+const spanKindInternal = 1
+
+func attribute(a Attribute) otlpAttribute {
+	var v otlpValue
+	switch value := a.Value.(type) {
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: a.Key, Value: v}
+}
+
+// encode returns the spans of the node as one ExportTraceServiceRequest
+func encode(node string, spans []*Span) ([]byte, error) {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/gitferry/bamboo"}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.SpanContext.TraceID.String(),
+			SpanID:            s.SpanContext.SpanID.String(),
+			Name:              s.Name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: unixNano(s.Start),
+			EndTimeUnixNano:   unixNano(s.End),
+		}
+		if s.Parent != (SpanID{}) {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, a := range s.Attrs {
+			span.Attributes = append(span.Attributes, attribute(a))
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			attribute(String("service.name", "bamboo")),
+			attribute(String("service.instance.id", node)),
+		}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}})
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// fileExporter appends a request per line to trace.<node>.json in the directory,
+// the format read by the otlpjsonfile receiver of the OpenTelemetry collector
+type fileExporter struct {
+	node string
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileExporter(dir, node string) (*fileExporter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filepath.Join(dir, "trace."+node+".json"))
+	if err != nil {
+		return nil, err
+	}
+	return &fileExporter{node: node, file: file}, nil
+}
+
+func (e *fileExporter) Export(spans []*Span) error {
+	b, err := encode(e.node, spans)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	w := bufio.NewWriter(e.file)
+	w.Write(b)
+	w.WriteByte('\n')
+	return w.Flush()
+}
+
+// httpExporter posts the spans to an OTLP/HTTP collector
+type httpExporter struct {
+	url  string
+	node string
+}
+
+func newHTTPExporter(url, node string) *httpExporter {
+	return &httpExporter{url: url, node: node}
+}
+
+func (e *httpExporter) Export(spans []*Span) error {
+	b, err := encode(e.node, spans)
+	if err != nil {
+		return err
+	}
+	r, err := http.Post(e.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("trace collector %s: %s", e.url, r.Status)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package trace records spans of the lifecycle of blocks and exports them
+// in the OTLP JSON encoding, to a file or to an OTLP/HTTP collector.
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/log"
+)
+
+var output = flag.String("trace", "", "directory to write the spans of every replica to as OTLP JSON, or url of an OTLP/HTTP collector, e.g. http://localhost:4318/v1/traces; disabled if empty")
+
+const (
+	flushInterval = time.Second
+	flushSize     = 512 // spans exported at once
+)
+
+// TraceID identifies a trace, all spans of a block share the trace of its proposal
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// Context is carried by messages for the receivers to continue the trace
+type Context struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// IsValid tells whether the context belongs to a trace
+func (c Context) IsValid() bool {
+	return c.TraceID != TraceID{}
+}
+
+// Attribute is a key value pair describing a span, values are strings or int64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{key, value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int64) Attribute {
+	return Attribute{key, value}
+}
+
+// Span is a timed operation of a replica
+type Span struct {
+	SpanContext Context
+	Parent      SpanID
+	Name        string
+	Start       time.Time
+	End         time.Time
+	Attrs       []Attribute
+
+	tracer *Tracer
+}
+
+// Context returns the context for the children of the span
+func (s *Span) Context() Context {
+	if s == nil {
+		return Context{}
+	}
+	return s.SpanContext
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// Finish ends the span now and queues it for export
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.End = time.Now()
+	s.tracer.add(s)
+}
+
+// Exporter sends the spans of a replica out
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// Tracer buffers the spans of a replica and exports them periodically,
+// all methods of a nil tracer do nothing
+type Tracer struct {
+	exporter Exporter
+
+	mu     sync.Mutex
+	buffer []*Span
+}
+
+// New returns the tracer of the node as configured by the -trace flag, nil if tracing is disabled
+func New(node string) *Tracer {
+	if *output == "" {
+		return nil
+	}
+	var exporter Exporter
+	var err error
+	if isURL(*output) {
+		exporter = newHTTPExporter(*output, node)
+	} else {
+		exporter, err = newFileExporter(*output, node)
+	}
+	if err != nil {
+		log.Errorf("tracing is disabled: %v", err)
+		return nil
+	}
+	return NewTracer(exporter)
+}
+
+// NewTracer returns a tracer exporting to the exporter
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{exporter: exporter}
+	go t.run()
+	return t
+}
+
+// Start starts a span now, as a child of the parent or in a new trace if the parent is not valid
+func (t *Tracer) Start(name string, parent Context, attrs ...Attribute) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{
+		SpanContext: parent,
+		Parent:      parent.SpanID,
+		Name:        name,
+		Start:       time.Now(),
+		Attrs:       attrs,
+		tracer:      t,
+	}
+	if !parent.IsValid() {
+		rand.Read(s.SpanContext.TraceID[:])
+		s.Parent = SpanID{}
+	}
+	rand.Read(s.SpanContext.SpanID[:])
+	return s
+}
+
+// Record records a finished span and returns its context
+func (t *Tracer) Record(name string, parent Context, start, end time.Time, attrs ...Attribute) Context {
+	s := t.Start(name, parent, attrs...)
+	if s == nil {
+		return Context{}
+	}
+	s.Start, s.End = start, end
+	t.add(s)
+	return s.SpanContext
+}
+
+func (t *Tracer) add(s *Span) {
+	t.mu.Lock()
+	t.buffer = append(t.buffer, s)
+	full := len(t.buffer) >= flushSize
+	t.mu.Unlock()
+	if full {
+		t.Flush()
+	}
+}
+
+// Flush exports the buffered spans
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.buffer
+	t.buffer = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(spans); err != nil {
+		log.Error(err)
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(flushInterval)
+	for range ticker.C {
+		t.Flush()
+	}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
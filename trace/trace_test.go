@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryExporter struct {
+	spans []*Span
+}
+
+func (e *memoryExporter) Export(spans []*Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func TestTrace(t *testing.T) {
+	e := new(memoryExporter)
+	tracer := NewTracer(e)
+	root := tracer.Start("propose", Context{}, Int("view", 3))
+	require.True(t, root.Context().IsValid())
+	child := tracer.Record("commit", root.Context(), time.Now(), time.Now(), String("node", "1"))
+	root.Finish()
+	tracer.Flush()
+
+	require.Len(t, e.spans, 2)
+	require.Equal(t, root.Context().TraceID, child.TraceID)
+	require.Equal(t, root.Context().SpanID, e.spans[0].Parent)
+	require.Equal(t, SpanID{}, e.spans[1].Parent)
+
+	b, err := encode("1", e.spans)
+	require.NoError(t, err)
+	var r otlpRequest
+	require.NoError(t, json.Unmarshal(b, &r))
+	spans := r.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Equal(t, "commit", spans[0].Name)
+	require.Equal(t, root.Context().SpanID.String(), spans[0].ParentSpanID)
+	require.Equal(t, "3", *spans[1].Attributes[0].Value.IntValue)
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	span := tracer.Start("propose", Context{})
+	span.SetAttributes(String("a", "b"))
+	span.Finish()
+	require.False(t, span.Context().IsValid())
+	require.False(t, tracer.Record("commit", Context{}, time.Now(), time.Now()).IsValid())
+}
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gitferry/bamboo/log"
 )
@@ -34,8 +35,14 @@ type Transport interface {
 
 	// Close closes send channel and stops listener
 	Close()
+
+	// SetMeter sets the meter told the encoded size of every message sent
+	SetMeter(Meter)
 }
 
+// Meter is told the encoded size in bytes of a message sent, messages of the chan scheme are not encoded
+type Meter func(m interface{}, bytes int)
+
 // NewTransport creates new transport object with url
 func NewTransport(addr string) Transport {
 	if !strings.Contains(addr, "://") {
@@ -77,6 +84,7 @@ type transport struct {
 	send  chan interface{}
 	recv  chan interface{}
 	close chan struct{}
+	meter atomic.Value // Meter, set while the transport sends
 }
 
 func (t *transport) Send(m interface{}) {
@@ -92,6 +100,17 @@ func (t *transport) Close() {
 	close(t.close)
 }
 
+func (t *transport) SetMeter(meter Meter) {
+	t.meter.Store(meter)
+}
+
+// measure tells the meter, if any, the encoded size of the message sent
+func (t *transport) measure(m interface{}, bytes int) {
+	if meter, ok := t.meter.Load().(Meter); ok && meter != nil {
+		meter(m, bytes)
+	}
+}
+
 func (t *transport) Scheme() string {
 	return t.uri.Scheme
 }
@@ -105,19 +124,34 @@ func (t *transport) Dial() error {
 	go func(conn net.Conn) {
 		// w := bufio.NewWriter(conn)
 		// codec := NewCodec(config.Codec, conn)
-		encoder := gob.NewEncoder(conn)
+		w := &countingWriter{w: conn}
+		encoder := gob.NewEncoder(w)
 		defer conn.Close()
 		for m := range t.send {
+			n := w.n
 			err := encoder.Encode(&m)
 			if err != nil {
 				log.Error(err)
 			}
+			t.measure(m, w.n-n)
 		}
 	}(conn)
 
 	return nil
 }
 
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w net.Conn
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
 /******************************
 /*     TCP communication      *
 /******************************/
@@ -189,6 +223,7 @@ func (u *udp) Dial() error {
 		w := new(bytes.Buffer)
 		for m := range u.send {
 			gob.NewEncoder(w).Encode(&m)
+			u.measure(m, w.Len())
 			_, err := conn.Write(w.Bytes())
 			if err != nil {
 				log.Error(err)
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/message"
+)
+
+// Batch is a batch of transactions disseminated ahead of the proposals,
+// blocks refer to it by its digest
+type Batch struct {
+	Digest crypto.Identifier
+	Worker identity.NodeID
+	Txns   []*message.Transaction
+}
+
+type rawTxn struct {
+	ID      string
+	Command db.Command
+}
+
+type rawBatch struct {
+	Worker identity.NodeID
+	Txns   []rawTxn
+}
+
+// MakeBatch creates the batch of the transactions sealed by the worker
+func MakeBatch(worker identity.NodeID, txns []*message.Transaction) *Batch {
+	b := &Batch{Worker: worker, Txns: txns}
+	b.Digest = b.digest()
+	return b
+}
+
+// digest covers the ids and commands of the transactions so that a batch cannot be
+// replaced by another of the same digest
+func (b *Batch) digest() crypto.Identifier {
+	raw := rawBatch{Worker: b.Worker, Txns: make([]rawTxn, 0, len(b.Txns))}
+	for _, txn := range b.Txns {
+		raw.Txns = append(raw.Txns, rawTxn{ID: txn.ID, Command: txn.Command})
+	}
+	return crypto.MakeID(raw)
+}
+
+// Verify reports whether the transactions match the digest
+func (b *Batch) Verify() bool {
+	return b.digest() == b.Digest
+}
+
+// BatchRequest asks for a batch missing at the requester
+type BatchRequest struct {
+	Digest    crypto.Identifier
+	Requester identity.NodeID
+}
@@ -0,0 +1,355 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gitferry/bamboo/config"
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/mempool"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/node"
+)
+
+// retryInterval is how long a missing batch is waited for before it is requested from every replica
+const retryInterval = time.Second
+
+// committedWindow is the number of committed batches kept for the replicas catching up
+const committedWindow = 1000
+
+// batchLifetime is how long a batch that is neither committed nor waiting to be proposed
+// is kept, the batches of blocks that never commit are collected after it
+const batchLifetime = time.Minute
+
+// Worker seals the transactions of the memory pool into batches and disseminates them to
+// the other replicas ahead of the proposals, so that blocks only carry the digests
+type Worker struct {
+	node   node.Node
+	pd     *mempool.Producer
+	logger *log.Logger
+	size   int           // transactions per batch
+	delay  time.Duration // between sealing batches
+	limit  int           // transactions sealed but not proposed
+
+	mu        sync.Mutex
+	batches   map[crypto.Identifier]*Batch
+	stored    map[crypto.Identifier]time.Time // when the batches not committed yet were stored
+	sealed    []crypto.Identifier             // own batches not proposed, oldest first
+	sealedTxs int
+	awaits    map[waiter]*await
+	waiters   map[crypto.Identifier]map[waiter]bool // the waiters of each missing batch
+	requested map[crypto.Identifier]time.Time
+	committed []crypto.Identifier // ring of the committed batches, pruned when overwritten
+	next      int
+}
+
+// waiter is a block waiting for its batches, to be processed or to be committed
+type waiter struct {
+	block     crypto.Identifier
+	committed bool
+}
+
+// await is a wait for the batches of a block
+type await struct {
+	missing map[crypto.Identifier]bool
+	done    func()
+}
+
+// New returns nil if the workers are disabled
+func New(n node.Node, pd *mempool.Producer) *Worker {
+	if !config.GetConfig().Workers {
+		return nil
+	}
+	size := config.GetConfig().WorkerBatch
+	if size <= 0 {
+		size = 1
+	}
+	delay := time.Duration(config.GetConfig().WorkerDelay) * time.Millisecond
+	if delay <= 0 {
+		log.Fatalf("worker_delay must be positive, got %v", config.GetConfig().WorkerDelay)
+	}
+	limit := 2 * config.GetConfig().BSize
+	if limit < size {
+		limit = size
+	}
+	return &Worker{
+		node:      n,
+		pd:        pd,
+		logger:    log.With("node", n.ID()),
+		size:      size,
+		delay:     delay,
+		limit:     limit,
+		batches:   make(map[crypto.Identifier]*Batch),
+		stored:    make(map[crypto.Identifier]time.Time),
+		awaits:    make(map[waiter]*await),
+		waiters:   make(map[crypto.Identifier]map[waiter]bool),
+		requested: make(map[crypto.Identifier]time.Time),
+		committed: make([]crypto.Identifier, committedWindow),
+	}
+}
+
+// Run seals batches, requests the missing ones again and collects the old ones until the replica stops
+func (w *Worker) Run() {
+	ticker := time.NewTicker(w.delay)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		w.seal()
+		w.retry()
+		w.collect(now)
+	}
+}
+
+// seal moves transactions of the memory pool into batches, a partial batch is sealed
+// when the memory pool has no more, unless enough transactions wait to be proposed
+func (w *Worker) seal() {
+	for {
+		w.mu.Lock()
+		if w.sealedTxs >= w.limit {
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+		txns := w.pd.Take(w.size)
+		if len(txns) == 0 {
+			return
+		}
+		batch := MakeBatch(w.node.ID(), txns)
+		w.mu.Lock()
+		w.batches[batch.Digest] = batch
+		w.stored[batch.Digest] = time.Now()
+		w.sealed = append(w.sealed, batch.Digest)
+		w.sealedTxs += len(txns)
+		w.mu.Unlock()
+		w.node.Broadcast(*batch)
+		w.logger.Debugw("sealed a batch", "digest", batch.Digest, "transactions", len(txns))
+		if len(txns) < w.size {
+			return
+		}
+	}
+}
+
+// Propose takes the digests of the oldest sealed batches holding up to n transactions,
+// at least one batch if there is any, and returns them with the number of transactions
+func (w *Worker) Propose(n int) ([]crypto.Identifier, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var digests []crypto.Identifier
+	txs := 0
+	for len(w.sealed) > 0 {
+		batch := w.batches[w.sealed[0]]
+		if len(digests) > 0 && txs+len(batch.Txns) > n {
+			break
+		}
+		digests = append(digests, batch.Digest)
+		txs += len(batch.Txns)
+		w.sealed = w.sealed[1:]
+	}
+	w.sealedTxs -= txs
+	return digests, txs
+}
+
+// Requeue puts back the batches of a forked block to be proposed first
+func (w *Worker) Requeue(digests []crypto.Identifier) {
+	if w == nil || len(digests) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sealed := make([]crypto.Identifier, 0, len(digests)+len(w.sealed))
+	for _, d := range digests {
+		if batch, ok := w.batches[d]; ok {
+			sealed = append(sealed, d)
+			w.sealedTxs += len(batch.Txns)
+		}
+	}
+	w.sealed = append(sealed, w.sealed...)
+}
+
+// HandleBatch stores a batch disseminated by another worker
+func (w *Worker) HandleBatch(batch Batch) {
+	if !batch.Verify() {
+		w.logger.Warningw("dropped a batch not matching its digest", "worker", batch.Worker, "digest", batch.Digest)
+		return
+	}
+	if err := mempool.CheckBytes(batch.Txns); err != nil {
+		w.logger.Warningw("dropped an oversized batch", "worker", batch.Worker, "digest", batch.Digest, "error", err)
+		return
+	}
+	if err := mempool.CheckSignatures(batch.Txns); err != nil {
+		w.logger.Warningw("dropped a batch with a forged transaction", "worker", batch.Worker, "digest", batch.Digest, "error", err)
+		return
+	}
+	w.mu.Lock()
+	if _, ok := w.batches[batch.Digest]; ok {
+		w.mu.Unlock()
+		return
+	}
+	w.batches[batch.Digest] = &batch
+	w.stored[batch.Digest] = time.Now()
+	delete(w.requested, batch.Digest)
+	var done []func()
+	for wt := range w.waiters[batch.Digest] {
+		a := w.awaits[wt]
+		delete(a.missing, batch.Digest)
+		if len(a.missing) == 0 {
+			done = append(done, a.done)
+			delete(w.awaits, wt)
+		}
+	}
+	delete(w.waiters, batch.Digest)
+	w.mu.Unlock()
+	for _, f := range done {
+		f()
+	}
+}
+
+// HandleBatchRequest sends the batch to the requester if the worker has it
+func (w *Worker) HandleBatchRequest(req BatchRequest) {
+	w.mu.Lock()
+	batch, ok := w.batches[req.Digest]
+	w.mu.Unlock()
+	if ok {
+		w.node.Send(req.Requester, *batch)
+	}
+}
+
+// Await returns true if all the batches of the block are available, otherwise the missing
+// ones are requested from the proposer and done is called once they have all arrived
+func (w *Worker) Await(block crypto.Identifier, digests []crypto.Identifier, from identity.NodeID, done func()) bool {
+	if w == nil || len(digests) == 0 {
+		return true
+	}
+	return w.await(waiter{block: block}, digests, from, done)
+}
+
+// await registers the wait of the waiter, a waiter asking again replaces its previous wait
+func (w *Worker) await(wt waiter, digests []crypto.Identifier, from identity.NodeID, done func()) bool {
+	w.mu.Lock()
+	if a, ok := w.awaits[wt]; ok {
+		for d := range a.missing {
+			delete(w.waiters[d], wt)
+			if len(w.waiters[d]) == 0 {
+				delete(w.waiters, d)
+			}
+		}
+		delete(w.awaits, wt)
+	}
+	missing := make(map[crypto.Identifier]bool)
+	var requests []crypto.Identifier
+	for _, d := range digests {
+		if _, ok := w.batches[d]; ok {
+			continue
+		}
+		missing[d] = true
+		if _, ok := w.requested[d]; !ok {
+			w.requested[d] = time.Now()
+			requests = append(requests, d)
+		}
+	}
+	if len(missing) == 0 {
+		w.mu.Unlock()
+		return true
+	}
+	w.awaits[wt] = &await{missing: missing, done: done}
+	for d := range missing {
+		if w.waiters[d] == nil {
+			w.waiters[d] = make(map[waiter]bool)
+		}
+		w.waiters[d][wt] = true
+	}
+	w.mu.Unlock()
+	for _, d := range requests {
+		w.logger.Debugw("requested a missing batch", "digest", d, "from", from)
+		w.node.Send(from, BatchRequest{Digest: d, Requester: w.node.ID()})
+	}
+	return false
+}
+
+// retry requests the batches missing for too long from every replica
+func (w *Worker) retry() {
+	w.mu.Lock()
+	var requests []crypto.Identifier
+	now := time.Now()
+	for d, t := range w.requested {
+		if now.Sub(t) >= retryInterval {
+			w.requested[d] = now
+			requests = append(requests, d)
+		}
+	}
+	w.mu.Unlock()
+	for _, d := range requests {
+		w.node.Broadcast(BatchRequest{Digest: d, Requester: w.node.ID()})
+	}
+}
+
+// Payload returns the transactions of the batches of the committed block in order and true if
+// all of them are available, otherwise the missing ones are requested and done is called once
+// they have arrived
+func (w *Worker) Payload(block crypto.Identifier, digests []crypto.Identifier, from identity.NodeID, done func()) ([]*message.Transaction, bool) {
+	if w == nil || len(digests) == 0 {
+		return nil, true
+	}
+	for {
+		if !w.await(waiter{block: block, committed: true}, digests, from, done) {
+			return nil, false
+		}
+		if txns, ok := w.payload(digests); ok {
+			return txns, true
+		}
+		// a batch was collected since, it is requested again
+	}
+}
+
+func (w *Worker) payload(digests []crypto.Identifier) ([]*message.Transaction, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var txns []*message.Transaction
+	for _, d := range digests {
+		batch, ok := w.batches[d]
+		if !ok {
+			return nil, false
+		}
+		txns = append(txns, batch.Txns...)
+	}
+	return txns, true
+}
+
+// Committed remembers the committed batches, the oldest ones are forgotten
+func (w *Worker) Committed(digests []crypto.Identifier) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, d := range digests {
+		delete(w.batches, w.committed[w.next])
+		delete(w.stored, d)
+		w.committed[w.next] = d
+		w.next = (w.next + 1) % len(w.committed)
+	}
+}
+
+// collect forgets the batches stored longer than their lifetime that are neither committed
+// nor waiting to be proposed, such as the batches of forked blocks of other proposers
+func (w *Worker) collect(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	sealed := make(map[crypto.Identifier]bool, len(w.sealed))
+	for _, d := range w.sealed {
+		sealed[d] = true
+	}
+	collected := 0
+	for d, t := range w.stored {
+		if now.Sub(t) < batchLifetime || sealed[d] {
+			continue
+		}
+		delete(w.batches, d)
+		delete(w.stored, d)
+		collected++
+	}
+	if collected > 0 {
+		w.logger.Debugw("collected batches never committed", "batches", collected)
+	}
+}
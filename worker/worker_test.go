@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gitferry/bamboo/crypto"
+	"github.com/gitferry/bamboo/db"
+	"github.com/gitferry/bamboo/identity"
+	"github.com/gitferry/bamboo/log"
+	"github.com/gitferry/bamboo/message"
+	"github.com/gitferry/bamboo/node"
+	"github.com/stretchr/testify/require"
+)
+
+func batch(prefix string, n int) *Batch {
+	txns := make([]*message.Transaction, n)
+	for i := range txns {
+		txns[i] = &message.Transaction{ID: prefix + "." + strconv.Itoa(i), Command: db.Command{Key: db.Key(i)}}
+	}
+	return MakeBatch("1", txns)
+}
+
+// requestNode records the batch requests sent instead of sending them
+type requestNode struct {
+	node.Node
+	requests []BatchRequest
+}
+
+func (n *requestNode) ID() identity.NodeID {
+	return "2"
+}
+
+func (n *requestNode) Send(to identity.NodeID, m interface{}) {
+	n.requests = append(n.requests, m.(BatchRequest))
+}
+
+func newWorker() *Worker {
+	return &Worker{
+		node:      &requestNode{},
+		logger:    log.With("node", "2"),
+		batches:   make(map[crypto.Identifier]*Batch),
+		stored:    make(map[crypto.Identifier]time.Time),
+		awaits:    make(map[waiter]*await),
+		waiters:   make(map[crypto.Identifier]map[waiter]bool),
+		requested: make(map[crypto.Identifier]time.Time),
+		committed: make([]crypto.Identifier, 2),
+	}
+}
+
+func TestBatchDigest(t *testing.T) {
+	b := batch("a", 3)
+	require.True(t, b.Verify())
+	b.Txns[1].Command.Value = db.Value("changed")
+	require.False(t, b.Verify())
+}
+
+func TestProposeAndRequeue(t *testing.T) {
+	w := newWorker()
+	var digests []crypto.Identifier
+	for _, n := range []int{3, 3, 3} {
+		b := batch(strconv.Itoa(len(digests)), n)
+		w.batches[b.Digest] = b
+		w.sealed = append(w.sealed, b.Digest)
+		w.sealedTxs += n
+		digests = append(digests, b.Digest)
+	}
+	proposed, txs := w.Propose(7)
+	require.Equal(t, digests[:2], proposed)
+	require.Equal(t, 6, txs)
+	w.Requeue(proposed)
+	require.Equal(t, digests, w.sealed)
+	require.Equal(t, 9, w.sealedTxs)
+	// a batch larger than the block is proposed alone
+	proposed, txs = w.Propose(1)
+	require.Equal(t, digests[:1], proposed)
+	require.Equal(t, 3, txs)
+}
+
+func TestAwaitAndCommitted(t *testing.T) {
+	w := newWorker()
+	b := batch("a", 2)
+	w.batches[b.Digest] = b
+	block := crypto.MakeID("block")
+	require.True(t, w.Await(block, []crypto.Identifier{b.Digest}, "2", nil))
+
+	missing := batch("b", 2)
+	done := false
+	require.False(t, w.Await(block, []crypto.Identifier{b.Digest, missing.Digest}, "2", func() { done = true }))
+	w.HandleBatch(*missing)
+	require.True(t, done)
+	require.Empty(t, w.awaits)
+	require.Empty(t, w.waiters)
+
+	w.Committed([]crypto.Identifier{b.Digest, missing.Digest})
+	w.Committed([]crypto.Identifier{batch("c", 1).Digest})
+	_, ok := w.batches[b.Digest]
+	require.False(t, ok)
+	_, ok = w.batches[missing.Digest]
+	require.True(t, ok)
+}
+
+func TestPayloadMissing(t *testing.T) {
+	w := newWorker()
+	b := batch("a", 2)
+	missing := batch("b", 1)
+	digests := []crypto.Identifier{b.Digest, missing.Digest}
+	w.HandleBatch(*b)
+
+	arrived := 0
+	block := crypto.MakeID("block")
+	txns, ok := w.Payload(block, digests, "1", func() { arrived++ })
+	require.False(t, ok)
+	require.Nil(t, txns)
+	require.Equal(t, []BatchRequest{{Digest: missing.Digest, Requester: "2"}}, w.node.(*requestNode).requests)
+
+	w.HandleBatch(*missing)
+	require.Equal(t, 1, arrived)
+	txns, ok = w.Payload(block, digests, "1", nil)
+	require.True(t, ok)
+	require.Equal(t, append(b.Txns, missing.Txns...), txns)
+}
+
+func TestCollect(t *testing.T) {
+	w := newWorker()
+	forked := batch("a", 1)
+	committed := batch("b", 1)
+	sealed := batch("c", 1)
+	recent := batch("d", 1)
+	for _, b := range []*Batch{forked, committed, sealed, recent} {
+		w.HandleBatch(*b)
+	}
+	w.sealed = append(w.sealed, sealed.Digest)
+	w.Committed([]crypto.Identifier{committed.Digest})
+	now := time.Now()
+	w.stored[recent.Digest] = now.Add(batchLifetime / 2)
+
+	w.collect(now.Add(batchLifetime))
+	for _, b := range []*Batch{committed, sealed, recent} {
+		_, ok := w.batches[b.Digest]
+		require.True(t, ok)
+	}
+	_, ok := w.batches[forked.Digest]
+	require.False(t, ok)
+
+	// a collected batch referenced again is requested
+	_, ok = w.Payload(crypto.MakeID("block"), []crypto.Identifier{forked.Digest}, "1", func() {})
+	require.False(t, ok)
+}
+
+func TestAwaitRetried(t *testing.T) {
+	w := newWorker()
+	missing := batch("a", 1)
+	digests := []crypto.Identifier{missing.Digest}
+	block := crypto.MakeID("block")
+
+	// a block retried while its batch is missing waits once, processing and committing it are two waits
+	processed, committed := 0, 0
+	for i := 0; i < 3; i++ {
+		require.False(t, w.Await(block, digests, "1", func() { processed++ }))
+		_, ok := w.Payload(block, digests, "1", func() { committed++ })
+		require.False(t, ok)
+	}
+	require.Len(t, w.awaits, 2)
+	require.Len(t, w.waiters[missing.Digest], 2)
+	require.Len(t, w.node.(*requestNode).requests, 1)
+
+	w.HandleBatch(*missing)
+	require.Equal(t, 1, processed)
+	require.Equal(t, 1, committed)
+	require.Empty(t, w.awaits)
+	require.Empty(t, w.waiters)
+}